@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// autocertDomains splits the comma separated domains of -autocert-domains.
+// When the config sets a host, certificates must be requested for it, as it
+// is the host the vanity pages are served on.
+func autocertDomains(list, host string) ([]string, error) {
+	var domains []string
+
+	for _, domain := range strings.Split(list, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+
+	if host == "" {
+		return domains, nil
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for _, domain := range domains {
+		if strings.EqualFold(domain, host) {
+			return domains, nil
+		}
+	}
+
+	return nil, NewAutocertHostError(host)
+}
+
+// newAutocertManager returns a manager obtaining certificates for domains
+// from Let's Encrypt, cached in the cache directory.
+func newAutocertManager(domains []string, cache string) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(cache),
+	}
+}
+
+// withAutocert returns a copy of config getting its certificates from m,
+// which also answers the TLS-ALPN-01 challenge.
+func withAutocert(config *tls.Config, m *autocert.Manager) *tls.Config {
+	config = config.Clone()
+	config.GetCertificate = m.GetCertificate
+	config.NextProtos = append(config.NextProtos, "h2", "http/1.1", acme.ALPNProto)
+
+	return config
+}
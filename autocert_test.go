@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAutocertDomains(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		host    string
+		domains []string
+		err     bool
+	}{
+		{
+			name:    "without host",
+			list:    "example.com, go.example.com",
+			domains: []string{"example.com", "go.example.com"},
+		},
+		{
+			name:    "with host",
+			list:    "example.com,go.example.com",
+			host:    "go.example.com",
+			domains: []string{"example.com", "go.example.com"},
+		},
+		{
+			name:    "with host and port",
+			list:    "go.example.com",
+			host:    "go.example.com:8443",
+			domains: []string{"go.example.com"},
+		},
+		{
+			name: "host missing",
+			list: "example.com",
+			host: "go.example.com",
+			err:  true,
+		},
+	}
+	for _, test := range tests {
+		domains, err := autocertDomains(test.list, test.host)
+
+		var hostErr *AutocertHostError
+		if got := errors.As(err, &hostErr); got != test.err {
+			t.Errorf("%s: err = %v; want error %t", test.name, err, test.err)
+		}
+
+		if !reflect.DeepEqual(domains, test.domains) {
+			t.Errorf("%s: domains = %q; want %q", test.name, domains, test.domains)
+		}
+	}
+}
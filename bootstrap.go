@@ -0,0 +1,45 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// BootstrapHandler replies with 503 Service Unavailable and a Retry-After
+	// header until the handler serving requests is set, e.g. while the config
+	// is being fetched.
+	BootstrapHandler struct {
+		retryAfter time.Duration
+		handler    atomic.Pointer[http.Handler]
+	}
+)
+
+func (b *BootstrapHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h := b.handler.Load(); h != nil {
+		(*h).ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(b.retryAfter.Seconds()))))
+	http.Error(w, "starting up, configuration not loaded yet", http.StatusServiceUnavailable)
+}
+
+// Set makes h serve every subsequent request.
+func (b *BootstrapHandler) Set(h http.Handler) {
+	b.handler.Store(&h)
+}
+
+// Ready reports whether the handler has been set.
+func (b *BootstrapHandler) Ready() bool {
+	return b.handler.Load() != nil
+}
+
+// NewBootstrapHandler returns a BootstrapHandler advising clients to retry
+// after retryAfter, rounded up to the second and at least one second.
+func NewBootstrapHandler(retryAfter time.Duration) *BootstrapHandler {
+	return &BootstrapHandler{retryAfter: max(retryAfter, time.Second)}
+}
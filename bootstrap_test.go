@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBootstrapHandler(t *testing.T) {
+	b := NewBootstrapHandler(1500 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/portmidi", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("bootstrapping: status = %d; want %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	if got, want := w.Header().Get("Retry-After"), "2"; got != want {
+		t.Errorf("bootstrapping: Retry-After = %q; want %q", got, want)
+	}
+
+	if b.Ready() {
+		t.Error("bootstrapping: Ready() = true; want false")
+	}
+
+	b.Set(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	w = httptest.NewRecorder()
+	b.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/portmidi", nil))
+
+	if w.Code != http.StatusTeapot {
+		t.Errorf("ready: status = %d; want %d", w.Code, http.StatusTeapot)
+	}
+
+	if got := w.Header().Get("Retry-After"); got != "" {
+		t.Errorf("ready: Retry-After = %q; want empty", got)
+	}
+
+	if !b.Ready() {
+		t.Error("ready: Ready() = false; want true")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	configFetchTimeout = 10 * time.Second
+)
+
+// isRemoteConfig reports whether the config at path is fetched over HTTP.
+func isRemoteConfig(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// configFormat returns format if set, otherwise the format of the config at
+// path guessed from its extension or, lacking a known one, from its content,
+// defaulting to YAML.
+func configFormat(path, format string, config []byte) string {
+	switch {
+	case format != "":
+		return format
+	case strings.HasSuffix(path, ".json"):
+		return "json"
+	case strings.HasSuffix(path, ".toml"):
+		return "toml"
+	case strings.HasSuffix(path, ".yaml"), strings.HasSuffix(path, ".yml"):
+		return "yaml"
+	case bytes.HasPrefix(bytes.TrimSpace(config), []byte("{")) && json.Valid(config):
+		return "json"
+	case isTOML(config):
+		return "toml"
+	default:
+		return "yaml"
+	}
+}
+
+// isTOML reports whether config is a TOML document, but not a YAML mapping.
+// TOML tables and key = value pairs aren't valid YAML mappings, while an
+// empty document is both and considered YAML.
+func isTOML(config []byte) bool {
+	var doc map[string]any
+	if yaml.Unmarshal(config, &doc) == nil {
+		return false
+	}
+
+	return toml.Unmarshal(config, &doc) == nil
+}
+
+// readConfig reads the raw config at path, which is either a local file, an
+// http(s) URL or "-" for stdin.
+func readConfig(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	if !isRemoteConfig(path) {
+		return os.ReadFile(path)
+	}
+
+	client := &http.Client{Timeout: configFetchTimeout}
+
+	resp, err := client.Get(path)
+	if err != nil {
+		// Timeouts are reported as such by the client.
+		return nil, fmt.Errorf("fetching config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, NewConfigStatusError(path, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
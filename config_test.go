@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+)
+
+func TestReadConfig(t *testing.T) {
+	const config = "paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/vanity.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write([]byte(config))
+	}))
+	defer srv.Close()
+
+	got, err := readConfig(srv.URL + "/vanity.yaml")
+	if err != nil {
+		t.Fatalf("readConfig: %v", err)
+	}
+
+	if string(got) != config {
+		t.Errorf("readConfig = %q; want %q", got, config)
+	}
+
+	var statusErr *ConfigStatusError
+	if _, err := readConfig(srv.URL + "/missing.yaml"); !errors.As(err, &statusErr) {
+		t.Errorf("readConfig(missing) error = %v; want a ConfigStatusError", err)
+	}
+}
+
+func TestReadConfigStdin(t *testing.T) {
+	const config = "paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+
+	os.Stdin = r
+
+	go func() {
+		_, _ = w.WriteString(config)
+		w.Close()
+	}()
+
+	got, err := readConfig("-")
+	if err != nil {
+		t.Fatalf("readConfig: %v", err)
+	}
+
+	if string(got) != config {
+		t.Errorf("readConfig = %q; want %q", got, config)
+	}
+}
+
+func TestConfigFormat(t *testing.T) {
+	const (
+		yamlConfig = "paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"
+		jsonConfig = `{"paths": {"/portmidi": {"repo": "https://github.com/rakyll/portmidi"}}}`
+		flowConfig = "{paths: {/portmidi: {repo: https://github.com/rakyll/portmidi}}}"
+		tomlConfig = "[paths.\"/portmidi\"]\nrepo = \"https://github.com/rakyll/portmidi\"\n"
+	)
+
+	tests := []struct {
+		path   string
+		format string
+		config string
+		want   string
+	}{
+		{"vanity.yaml", "", yamlConfig, "yaml"},
+		{"vanity.json", "", jsonConfig, "json"},
+		{"https://example.com/vanity.json", "", jsonConfig, "json"},
+		{"vanity", "", yamlConfig, "yaml"},
+		{"vanity", "", "\n " + jsonConfig, "json"},
+		{"vanity", "", flowConfig, "yaml"},
+		{"vanity.toml", "", tomlConfig, "toml"},
+		{"vanity", "", tomlConfig, "toml"},
+		{"vanity", "", "host = \"example.com\"\n", "toml"},
+		{"vanity", "", "", "yaml"},
+		{"vanity.yaml", "", jsonConfig, "yaml"},
+		{"vanity", "json", yamlConfig, "json"},
+		{"vanity.json", "yaml", jsonConfig, "yaml"},
+	}
+	for _, test := range tests {
+		if got := configFormat(test.path, test.format, []byte(test.config)); got != test.want {
+			t.Errorf("configFormat(%q, %q, %q) = %q; want %q", test.path, test.format, test.config, got, test.want)
+		}
+	}
+}
+
+func TestConfigFormatRoundTrip(t *testing.T) {
+	const (
+		yamlConfig = "host: example.com\n" +
+			"default_branch: main\n" +
+			"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n" +
+			"  /gopdf:\n" +
+			"    repo: https://bitbucket.org/zombiezen/gopdf\n" +
+			"    vcs: hg\n" +
+			"    branch: stable\n" +
+			"  /forge:\n" +
+			"    repo: https://forge.example.com/acme/forge\n" +
+			"    vcs: git\n" +
+			"    display: https://forge.example.com/acme/forge _ _\n"
+		jsonConfig = `{
+  "host": "example.com",
+  "default_branch": "main",
+  "paths": {
+    "/portmidi": {"repo": "https://github.com/rakyll/portmidi"},
+    "/gopdf": {"repo": "https://bitbucket.org/zombiezen/gopdf", "vcs": "hg", "branch": "stable"},
+    "/forge": {"repo": "https://forge.example.com/acme/forge", "vcs": "git", "display": "https://forge.example.com/acme/forge _ _"}
+  }
+}`
+		tomlConfig = `host = "example.com"
+default_branch = "main"
+
+[paths."/portmidi"]
+repo = "https://github.com/rakyll/portmidi"
+
+[paths."/gopdf"]
+repo = "https://bitbucket.org/zombiezen/gopdf"
+vcs = "hg"
+branch = "stable"
+
+[paths."/forge"]
+repo = "https://forge.example.com/acme/forge"
+vcs = "git"
+display = "https://forge.example.com/acme/forge _ _"
+`
+	)
+
+	var handlers []*vanity.Handler
+
+	for _, config := range []string{yamlConfig, jsonConfig, tomlConfig} {
+		parsed, err := vanity.ParseConfigFormat([]byte(config), configFormat("-", "", []byte(config)))
+		if err != nil {
+			t.Fatalf("ParseConfigFormat: %v", err)
+		}
+
+		h, err := vanity.NewHandlerFromConfig(parsed)
+		if err != nil {
+			t.Fatalf("NewHandlerFromConfig: %v", err)
+		}
+
+		handlers = append(handlers, h)
+	}
+
+	for i, format := range []string{"JSON", "TOML"} {
+		if got, want := handlers[i+1].PathConfigs(), handlers[0].PathConfigs(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s paths = %+v; YAML paths = %+v", format, got, want)
+		}
+	}
+}
@@ -3,26 +3,54 @@ package main
 import (
 	"errors"
 	"fmt"
+	"net/http"
 )
 
 var (
-	ErrInvalidConfig       = errors.New("invalid config")
-	ErrCacheMaxAgeNegative = errors.New("cache-max-age must be positive")
-	ErrHTTPHostMissing     = errors.New("host is required")
-	ErrUnableToRender      = errors.New("error rendering HTTP response")
+	ErrWatchRequiresFile  = errors.New("-watch requires CONFIG to be a local file")
+	ErrTLSEnvIncomplete   = errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	ErrTLSFlagsIncomplete = errors.New("-tls-cert and -tls-key must be set together")
+	ErrAutocertConflict   = errors.New("-autocert-domains cannot be combined with TLS certificate files")
+	ErrInvalidLogFormat   = errors.New("-log-format must be text or json")
+	ErrInvalidCompression = errors.New("COMPRESS_RESPONSES must be true or false")
 )
 
 type (
-	InvalidVCSError struct {
-		path string
-		repo string
+	ConfigStatusError struct {
+		url    string
+		status string
+	}
+
+	RepoStatusError struct {
+		repo   string
+		status int
+	}
+
+	AutocertHostError struct {
+		host string
 	}
 )
 
-func (e *InvalidVCSError) Error() string {
-	return fmt.Sprintf("configuration for %v: cannot infer VCS from %s", e.path, e.repo)
+func (e *ConfigStatusError) Error() string {
+	return fmt.Sprintf("fetching config from %s: %s", e.url, e.status)
+}
+
+func NewConfigStatusError(url, status string) error {
+	return &ConfigStatusError{url, status}
+}
+
+func (e *RepoStatusError) Error() string {
+	return fmt.Sprintf("repo %s: %d %s", e.repo, e.status, http.StatusText(e.status))
+}
+
+func NewRepoStatusError(repo string, status int) error {
+	return &RepoStatusError{repo, status}
+}
+
+func (e *AutocertHostError) Error() string {
+	return fmt.Sprintf("-autocert-domains must include the configured host %s", e.host)
 }
 
-func NewInvalidVCSError(path, repo string) error {
-	return &InvalidVCSError{path, repo}
+func NewAutocertHostError(host string) error {
+	return &AutocertHostError{host}
 }
@@ -1,8 +1,22 @@
 module github.com/GoogleCloudPlatform/govanityurls
 
-go 1.18
+go 1.24
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/felixge/httpsnoop v1.0.3
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/quic-go/quic-go v0.55.0
+	golang.org/x/crypto v0.41.0
 	gopkg.in/yaml.v2 v2.4.0
 )
+
+require (
+	github.com/quic-go/qpack v0.5.1 // indirect
+	golang.org/x/mod v0.27.0 // indirect
+	golang.org/x/net v0.43.0 // indirect
+	golang.org/x/sync v0.16.0 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
+	golang.org/x/tools v0.36.0 // indirect
+)
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type (
+	// limitListener is the net.Listener implementation for LimitListener.
+	limitListener struct {
+		net.Listener
+
+		maxPerIP int
+		maxAge   time.Duration
+
+		mu    sync.Mutex
+		conns map[string]int
+	}
+
+	// limitConn releases its slot in the limitListener it was accepted from
+	// when closed.
+	limitConn struct {
+		net.Conn
+
+		once    sync.Once
+		release func()
+		timer   *time.Timer // closes the connection after maxAge, if any
+	}
+)
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ip, _, err := net.SplitHostPort(c.RemoteAddr().String())
+		if err != nil {
+			ip = c.RemoteAddr().String()
+		}
+
+		if !l.acquire(ip) {
+			_ = c.Close()
+			continue
+		}
+
+		lc := &limitConn{Conn: c, release: func() { l.releaseIP(ip) }}
+
+		// The timer only uses the fields set above, as it may fire before
+		// lc.timer is.
+		if l.maxAge > 0 {
+			lc.timer = time.AfterFunc(l.maxAge, func() { _ = lc.close() })
+		}
+
+		return lc, nil
+	}
+}
+
+// acquire takes a connection slot for ip, reporting whether one was free.
+func (l *limitListener) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxPerIP > 0 && l.conns[ip] >= l.maxPerIP {
+		return false
+	}
+
+	l.conns[ip]++
+
+	return true
+}
+
+// releaseIP gives back a connection slot of ip.
+func (l *limitListener) releaseIP(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conns[ip]--; l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+func (c *limitConn) Close() error {
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+
+	return c.close()
+}
+
+// close closes the connection and releases its slot, once.
+func (c *limitConn) close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+
+	return err
+}
+
+// LimitListener returns a net.Listener that wraps l, immediately closing the
+// connections accepted beyond maxPerIP concurrent ones from the same IP, and
+// closing any connection open for longer than maxAge. Either limit is
+// disabled when zero.
+func LimitListener(l net.Listener, maxPerIP int, maxAge time.Duration) net.Listener {
+	return &limitListener{Listener: l, maxPerIP: maxPerIP, maxAge: maxAge, conns: make(map[string]int)}
+}
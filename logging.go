@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"io"
 	"net"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"time"
 	"unicode/utf8"
 
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
 	"github.com/felixge/httpsnoop"
 )
 
@@ -64,6 +66,12 @@ type (
 		TimeStamp  time.Time
 		StatusCode int
 		Size       int
+
+		// Duration is the time taken to serve the request.
+		Duration time.Duration
+
+		// ImportPath is the import path resolved by the handler, if any.
+		ImportPath string
 	}
 
 	// LogFormatter gives the signature of the formatter function passed to CustomLoggingHandler.
@@ -77,6 +85,23 @@ type (
 		handler   http.Handler
 		formatter LogFormatter
 	}
+
+	// jsonLogEntry is a log entry written by jsonLog.
+	jsonLogEntry struct {
+		Time       string  `json:"time"`
+		RemoteAddr string  `json:"remote_addr"`
+		Method     string  `json:"method"`
+		Host       string  `json:"host"`
+		Path       string  `json:"path"`
+		Proto      string  `json:"proto"`
+		Status     int     `json:"status"`
+		Bytes      int     `json:"bytes"`
+		DurationMS float64 `json:"duration_ms"`
+		Referer    string  `json:"referer,omitempty"`
+		UserAgent  string  `json:"user_agent,omitempty"`
+		TraceID    string  `json:"trace_id,omitempty"`
+		ImportPath string  `json:"import,omitempty"`
+	}
 )
 
 func (h loggingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -84,6 +109,8 @@ func (h loggingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	logger, w := makeLogger(w)
 	url := *req.URL
 
+	ctx, importPath := vanity.WithImportPath(req.Context())
+	req = req.WithContext(ctx)
 	h.handler.ServeHTTP(w, req)
 
 	if req.MultipartForm != nil {
@@ -96,6 +123,8 @@ func (h loggingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		TimeStamp:  t,
 		StatusCode: logger.Status(),
 		Size:       logger.Size(),
+		Duration:   time.Since(t),
+		ImportPath: *importPath,
 	}
 
 	h.formatter(h.writer, params)
@@ -264,6 +293,92 @@ func writeCombinedLog(writer io.Writer, params LogFormatterParams) {
 	_, _ = writer.Write(buf)
 }
 
+// extendedLog returns a LogFormatter writing log entries in Apache Common Log
+// Format, followed by the trace ID of their W3C trace context and/or the
+// import path resolved for them.
+func extendedLog(trace, importPath bool) LogFormatter {
+	return func(writer io.Writer, params LogFormatterParams) {
+		buf := buildCommonLogLine(params.Request, params.URL, params.TimeStamp, params.StatusCode, params.Size)
+
+		if trace {
+			buf = appendField(buf, "trace_id", vanity.TraceID(params.Request))
+		}
+
+		if importPath {
+			buf = appendField(buf, "import", params.ImportPath)
+		}
+
+		buf = append(buf, '\n')
+		_, _ = writer.Write(buf)
+	}
+}
+
+// writeJSONLog writes a log entry for req to w as a JSON object on a single
+// line, along with the trace ID of its W3C trace context and the import path
+// resolved for it, when known.
+func writeJSONLog(writer io.Writer, params LogFormatterParams) {
+	req := params.Request
+
+	remote, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		remote = req.RemoteAddr
+	}
+
+	buf, err := json.Marshal(jsonLogEntry{
+		Time:       params.TimeStamp.Format(time.RFC3339Nano),
+		RemoteAddr: remote,
+		Method:     req.Method,
+		Host:       req.Host,
+		Path:       params.URL.RequestURI(),
+		Proto:      req.Proto,
+		Status:     params.StatusCode,
+		Bytes:      params.Size,
+		DurationMS: float64(params.Duration) / float64(time.Millisecond),
+		Referer:    req.Referer(),
+		UserAgent:  req.UserAgent(),
+		TraceID:    vanity.TraceID(req),
+		ImportPath: params.ImportPath,
+	})
+	if err != nil {
+		return
+	}
+
+	buf = append(buf, '\n')
+	_, _ = writer.Write(buf)
+}
+
+// accessLog returns the LogFormatter of the -log-format format, text by
+// default. Text lines are followed by the trace ID and/or import path of
+// requests when enabled, which JSON entries always carry when known.
+func accessLog(format string, trace, importPath bool) (LogFormatter, error) {
+	switch format {
+	case "", "text":
+		if trace || importPath {
+			return extendedLog(trace, importPath), nil
+		}
+
+		return writeLog, nil
+	case "json":
+		return writeJSONLog, nil
+	}
+
+	return nil, ErrInvalidLogFormat
+}
+
+// appendField appends a key=value field to a log entry, with - as the value
+// when empty.
+func appendField(buf []byte, key, value string) []byte {
+	if value == "" {
+		value = "-"
+	}
+
+	buf = append(buf, ' ')
+	buf = append(buf, key...)
+	buf = append(buf, '=')
+
+	return appendQuoted(buf, value)
+}
+
 // CombinedLoggingHandler return a http.Handler that wraps h and logs requests to out in
 // Apache Combined Log Format.
 //
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+)
+
+func TestExtendedLogImportPath(t *testing.T) {
+	h, err := vanity.NewHandler([]byte("host: example.com\npaths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/portmidi?go-get=1", " import=example.com/portmidi\n"},
+		{"/portmidi/foo/bar?go-get=1", " import=example.com/portmidi/foo/bar\n"},
+		{"/missing", " import=-\n"},
+	}
+	for _, test := range tests {
+		var log bytes.Buffer
+
+		CustomLoggingHandler(&log, h, extendedLog(false, true)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if !strings.HasSuffix(log.String(), test.want) {
+			t.Errorf("%s: log = %q; want it to end with %q", test.path, log.String(), test.want)
+		}
+	}
+}
+
+func TestExtendedLogTraceID(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	var log bytes.Buffer
+
+	h := vanity.TraceContextHandler(CustomLoggingHandler(&log, http.NotFoundHandler(), extendedLog(true, false)))
+
+	r := httptest.NewRequest(http.MethodGet, "/portmidi", nil)
+	r.Header.Set("traceparent", traceparent)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if want := " trace_id=4bf92f3577b34da6a3ce929d0e0e4736\n"; !strings.HasSuffix(log.String(), want) {
+		t.Errorf("log = %q; want it to end with %q", log.String(), want)
+	}
+}
+
+func TestJSONLog(t *testing.T) {
+	h, err := vanity.NewHandler([]byte("host: example.com\npaths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		status     int
+		bytes      int
+		importPath string
+	}{
+		{
+			name:    "implicit status",
+			handler: func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("hello")) },
+			status:  http.StatusOK,
+			bytes:   5,
+		},
+		{
+			name:    "explicit status",
+			handler: http.NotFound,
+			status:  http.StatusNotFound,
+			bytes:   len("404 page not found\n"),
+		},
+		{
+			name:       "vanity path",
+			handler:    h.ServeHTTP,
+			status:     http.StatusOK,
+			importPath: "example.com/portmidi",
+		},
+	}
+	for _, test := range tests {
+		var log bytes.Buffer
+
+		r := httptest.NewRequest(http.MethodGet, "/portmidi?go-get=1", nil)
+		r.Header.Set("User-Agent", "Go-http-client/1.1")
+		CustomLoggingHandler(&log, test.handler, writeJSONLog).ServeHTTP(httptest.NewRecorder(), r)
+
+		var entry map[string]any
+		if err := json.Unmarshal(log.Bytes(), &entry); err != nil {
+			t.Fatalf("%s: log %q: %v", test.name, log.String(), err)
+		}
+
+		want := map[string]any{
+			"remote_addr": "192.0.2.1",
+			"method":      http.MethodGet,
+			"host":        "example.com",
+			"path":        "/portmidi?go-get=1",
+			"proto":       "HTTP/1.1",
+			"status":      float64(test.status),
+			"user_agent":  "Go-http-client/1.1",
+		}
+		if test.bytes > 0 {
+			want["bytes"] = float64(test.bytes)
+		}
+
+		if test.importPath != "" {
+			want["import"] = test.importPath
+		}
+
+		for key, value := range want {
+			if entry[key] != value {
+				t.Errorf("%s: %s = %v; want %v", test.name, key, entry[key], value)
+			}
+		}
+
+		if _, ok := entry["duration_ms"].(float64); !ok {
+			t.Errorf("%s: duration_ms = %v; want a number", test.name, entry["duration_ms"])
+		}
+
+		if !strings.HasSuffix(log.String(), "}\n") {
+			t.Errorf("%s: log = %q; want a single line", test.name, log.String())
+		}
+	}
+}
+
+func TestAccessLogFormat(t *testing.T) {
+	for _, format := range []string{"", "text", "json"} {
+		if _, err := accessLog(format, false, false); err != nil {
+			t.Errorf("accessLog(%q) = %v", format, err)
+		}
+	}
+
+	if _, err := accessLog("xml", false, false); err != ErrInvalidLogFormat {
+		t.Errorf("accessLog(%q) = %v; want %v", "xml", err, ErrInvalidLogFormat)
+	}
+}
@@ -12,77 +12,775 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// govanityurls serves Go vanity URLs.
 package main
 
 import (
+	"cmp"
+	"context"
 	"embed"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	// defaultDrainTimeout bounds the graceful shutdown when drain_timeout
+	// isn't set.
+	defaultDrainTimeout = 10 * time.Second
 )
 
 var (
 	//go:embed static
 	static embed.FS
+
+	// draining is set once a termination signal is received, failing /readyz
+	// so that load balancers stop routing new traffic.
+	draining int32
+
+	// active is the handler serving the config, once loaded.
+	active atomic.Pointer[vanity.Handler]
+
+	// reloading serializes reloads, which are triggered by both SIGHUP and
+	// the -watch file watcher.
+	reloading sync.Mutex
+)
+
+type (
+	// shutdowner is implemented by the HTTP and HTTP/3 servers.
+	shutdowner interface {
+		Shutdown(ctx context.Context) error
+		Close() error
+	}
+
+	// trackedServer is an HTTP server counting its open connections, so that
+	// those forcibly closed on shutdown can be reported.
+	trackedServer struct {
+		*http.Server
+
+		open atomic.Int64
+	}
+
+	// maxRequestsSignal is sent along termination signals once max_requests
+	// have been served.
+	maxRequestsSignal struct{}
+
+	// options are the settings given on the command line.
+	options struct {
+		loader loader
+
+		addr, port                     string
+		tlsCert, tlsKey                string
+		autocertDomains, autocertCache string
+		logFormat                      string
+		bootstrapRetry                 time.Duration
+
+		verbose, validate, verify, serveMetrics, watchConfig, trustProxy, redirectHTTPS bool
+	}
+
+	// loader loads the config at path, in the given format or guessed when
+	// empty, along with the optional canary overlay.
+	loader struct {
+		path     string
+		format   string
+		canary   string
+		selftest bool
+	}
 )
 
 func main() {
-	var configPath string
+	o := parseFlags()
+	boot := NewBootstrapHandler(o.bootstrapRetry)
+	parsed := o.start(boot)
+
+	sig := make(chan os.Signal, 1)
+
+	reached := func() {
+		select {
+		case sig <- maxRequestsSignal{}:
+		default: // already shutting down
+		}
+	}
+
+	mux := routes(parsed, boot, reached, o.serveMetrics)
+
+	if err := tlsFiles(parsed, o.tlsCert, o.tlsKey); err != nil {
+		log.Fatal(err)
+	}
+
+	manager := o.autocert(parsed)
+	servers := o.serve(parsed, o.middleware(parsed, mux), manager)
+
+	if parsed.SnapshotFile != "" {
+		go snapshots(parsed.SnapshotFile)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 
-	switch len(os.Args) {
+	go reloads(hup, boot, o.loader)
+
+	if o.watchConfig {
+		go func() {
+			if err := watch(boot, o.loader, nil); err != nil {
+				log.Fatalf("Watching %s: %v", o.loader.path, err)
+			}
+		}()
+	}
+
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	drain := defaultDrainTimeout
+	if parsed.DrainTimeout > 0 {
+		drain = time.Duration(parsed.DrainTimeout) * time.Second
+	}
+
+	if err := shutdown(sig, time.Duration(parsed.ShutdownDelay)*time.Second, drain, servers...); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseFlags parses the command line, exiting on usage errors.
+func parseFlags() options {
+	var o options
+
+	flag.BoolVar(&o.loader.selftest, "selftest", true, "render every page once before serving and exit on failure")
+	flag.StringVar(&o.loader.format, "config-format", "", "force the CONFIG format, yaml, json or toml, instead of guessing it from the extension")
+	flag.StringVar(&o.logFormat, "log-format", cmp.Or(os.Getenv("LOG_FORMAT"), "text"), "write access logs as text or json, LOG_FORMAT by default")
+	flag.BoolVar(&o.verbose, "verbose", false, "log the import path resolved for each request")
+	flag.StringVar(&o.loader.canary, "canary", "", "overlay the paths of this config on CONFIG for requests with the X-Vanity-Canary: 1 header")
+	flag.BoolVar(&o.validate, "validate", false, "check CONFIG and print its paths, then exit instead of serving")
+	flag.BoolVar(&o.verify, "verify-repos", false, "check that the repo of every path exists, then exit instead of serving")
+	flag.BoolVar(&o.serveMetrics, "metrics", false, "serve Prometheus metrics at /metrics")
+	flag.BoolVar(&o.watchConfig, "watch", false, "reload CONFIG whenever the file changes, as on SIGHUP")
+	flag.DurationVar(&o.bootstrapRetry, "bootstrap-retry", 0, "when a remote CONFIG can't be loaded at startup, serve 503 and retry at this interval instead of exiting")
+	flag.StringVar(&o.addr, "addr", "0.0.0.0", "listen on this address")
+	flag.StringVar(&o.port, "port", defaultPort(), "listen on this port, the PORT environment variable or 8080 by default")
+	flag.StringVar(&o.tlsCert, "tls-cert", "", "serve HTTPS with this certificate file, overriding tls_cert_file and TLS_CERT_FILE")
+	flag.StringVar(&o.tlsKey, "tls-key", "", "serve HTTPS with this key file, overriding tls_key_file and TLS_KEY_FILE")
+	flag.BoolVar(&o.trustProxy, "trust-proxy", false, "derive the host of requests from X-Forwarded-Host, only from trusted_proxies when set")
+	flag.BoolVar(&o.redirectHTTPS, "redirect-https", false, "permanently redirect plain HTTP requests to HTTPS")
+	flag.StringVar(&o.autocertDomains, "autocert-domains", "", "serve HTTPS with Let's Encrypt certificates for these comma separated domains, answering challenges on port 80")
+	flag.StringVar(&o.autocertCache, "autocert-cache", "certs", "cache the -autocert-domains certificates in this directory")
+
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: govanityurls [flags] [CONFIG]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	switch flag.NArg() {
+	case 0:
+		o.loader.path = "vanity.yaml"
 	case 1:
-		configPath = "vanity.yaml"
-	case 2:
-		configPath = os.Args[1]
+		o.loader.path = flag.Arg(0)
 	default:
-		log.Fatal("usage: govanityurls [CONFIG]")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	switch o.loader.format {
+	case "", "yaml", "json", "toml":
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	switch o.logFormat {
+	case "text", "json":
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if o.watchConfig && (o.loader.path == "-" || isRemoteConfig(o.loader.path)) {
+		log.Fatal(ErrWatchRequiresFile)
+	}
+
+	if (o.tlsCert == "") != (o.tlsKey == "") {
+		log.Fatal(ErrTLSFlagsIncomplete)
+	}
+
+	return o
+}
+
+// start loads the config and sets its handlers on boot, or exits once done
+// with -validate or -verify-repos. When a remote config can't be loaded with
+// -bootstrap-retry, it is retried in the background and an empty config is
+// returned.
+func (o options) start(boot *BootstrapHandler) *vanity.Config {
+	parsed, handler, serving, err := o.loader.load()
+
+	if o.validate {
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := reportPaths(os.Stdout, handler.PathConfigs()); err != nil {
+			log.Fatal(err)
+		}
+
+		os.Exit(0)
+	}
+
+	if o.verify {
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		os.Exit(reportRepos(os.Stdout, verifyRepos(&http.Client{Timeout: verifyTimeout}, handler.PathConfigs())))
+	}
+
+	if err != nil {
+		if o.bootstrapRetry <= 0 || !isRemoteConfig(o.loader.path) {
+			log.Fatal(err)
+		}
+
+		// Server settings are only read at startup, so they keep their
+		// defaults until the next restart.
+		log.Printf("Loading %s: %v, serving 503 until it succeeds", o.loader.path, err)
+
+		go bootstrap(boot, o.loader, o.bootstrapRetry)
+
+		return &vanity.Config{}
+	}
+
+	active.Store(handler)
+	boot.Set(serving)
+
+	return parsed
+}
+
+// autocert returns the manager of the -autocert-domains certificates, or nil
+// when not set.
+func (o options) autocert(parsed *vanity.Config) *autocert.Manager {
+	if o.autocertDomains == "" {
+		return nil
+	}
+
+	if parsed.TLSCertFile != "" {
+		log.Fatal(ErrAutocertConflict)
+	}
+
+	domains, err := autocertDomains(o.autocertDomains, parsed.Host)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	config, err := os.ReadFile(configPath)
+	return newAutocertManager(domains, o.autocertCache)
+}
+
+// middleware wraps mux with the compression, redirects, access logs and proxy
+// handling set by parsed and the flags.
+func (o options) middleware(parsed *vanity.Config, mux http.Handler) http.Handler {
+	compress, err := compressionFromEnv()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	handler, err := NewVanityHandler(config)
+	root := mux
+	if compress {
+		root = CompressHandler(root)
+	}
+
+	switch {
+	case parsed.HSTSPreload:
+		root = HSTSPreloadHandler(root)
+	case o.redirectHTTPS:
+		// hsts_preload already redirects to HTTPS.
+		root = HTTPSRedirectHandler(root)
+	}
+
+	formatter, err := accessLog(o.logFormat, parsed.TraceContext, o.verbose)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	http.Handle("/favicon.ico", http.HandlerFunc(favico))
-	http.Handle("/healthz", http.HandlerFunc(healthz))
-	http.Handle("/", handler)
+	logged := CustomLoggingHandler(os.Stdout, root, formatter)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if parsed.TraceContext {
+		logged = vanity.TraceContextHandler(logged)
 	}
 
-	log.Printf("Listening on 0.0.0.0:%s", port)
+	if o.trustProxy {
+		logged = vanity.ForwardedHostHandler(logged)
+	}
+
+	if len(parsed.TrustedProxies) > 0 {
+		// trusted_proxies was validated with the config.
+		trusted, _ := vanity.ParseTrustedProxies(parsed.TrustedProxies)
+		logged = vanity.ProxyHandler(trusted, logged)
+	}
+
+	return logged
+}
+
+// serve starts serving handler, along with the ACME challenges of manager
+// and HTTP/3 when enabled, and returns the servers to shut down.
+func (o options) serve(parsed *vanity.Config, handler http.Handler, manager *autocert.Manager) []shutdowner {
+	listen := net.JoinHostPort(o.addr, o.port)
+	log.Printf("Listening on %s", listen)
 
-	server := &http.Server{
-		Addr:              "0.0.0.0:" + port,
-		Handler:           LoggingHandler(os.Stdout, http.DefaultServeMux),
+	server := &trackedServer{Server: &http.Server{
+		Addr:              listen,
+		Handler:           handler,
 		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       time.Duration(parsed.ReadTimeout) * time.Second,
 		WriteTimeout:      10 * time.Second,
+	}}
+	server.ConnState = server.track
+
+	// The tls block was validated with the config.
+	server.TLSConfig, _ = parsed.TLS.Config()
+	servers := []shutdowner{server}
+
+	if manager != nil {
+		server.TLSConfig = withAutocert(server.TLSConfig, manager)
+		servers = append(servers, o.serveChallenges(manager))
 	}
 
-	if err := server.ListenAndServe(); err != nil {
+	if parsed.HTTP3 {
+		h3 := withHTTP3(server)
+		servers = append(servers, h3)
+
+		log.Printf("Listening on %s (HTTP/3)", listen)
+
+		go func() {
+			if err := h3.ListenAndServeTLS(parsed.TLSCertFile, parsed.TLSKeyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	lc := net.ListenConfig{KeepAlive: parsed.KeepAlive.Duration()}
+
+	ln, err := lc.Listen(context.Background(), "tcp", server.Addr)
+	if err != nil {
 		log.Fatal(err)
 	}
+
+	if parsed.MaxConnsPerIP > 0 || parsed.ConnMaxAge > 0 {
+		ln = LimitListener(ln, parsed.MaxConnsPerIP, time.Duration(parsed.ConnMaxAge)*time.Second)
+	}
+
+	go func() {
+		var err error
+
+		if parsed.TLSCertFile != "" || manager != nil {
+			err = server.ServeTLS(ln, parsed.TLSCertFile, parsed.TLSKeyFile)
+		} else {
+			err = server.Serve(ln)
+		}
+
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	return servers
 }
 
-func healthz(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte("ok"))
+// serveChallenges starts answering the ACME challenges of manager on port 80,
+// where HTTP-01 challenges are always sent, and other requests are redirected
+// to HTTPS.
+func (o options) serveChallenges(manager *autocert.Manager) *http.Server {
+	challenges := &http.Server{
+		Addr:              net.JoinHostPort(o.addr, "80"),
+		Handler:           manager.HTTPHandler(nil),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	log.Printf("Listening on %s (ACME challenges)", challenges.Addr)
+
+	go func() {
+		if err := challenges.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	return challenges
 }
 
-func favico(w http.ResponseWriter, r *http.Request) {
-	f, err := static.ReadFile("static/favicon.ico")
+func (maxRequestsSignal) String() string {
+	return "max_requests"
+}
+
+func (maxRequestsSignal) Signal() {}
+
+func (s *trackedServer) track(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		s.open.Add(1)
+	case http.StateClosed, http.StateHijacked:
+		s.open.Add(-1)
+	case http.StateActive, http.StateIdle:
+	}
+}
+
+// withHTTP3 returns the HTTP/3 server serving the handler of server on the
+// same port, and has server advertise it.
+func withHTTP3(server *trackedServer) *http3.Server {
+	h3 := &http3.Server{Addr: server.Addr, Handler: server.Handler}
+	server.Handler = AltSvcHandler(h3, server.Handler)
+
+	return h3
+}
+
+// routes returns the handler serving the static files, health checks and
+// metrics, and boot for any other path, calling reached once max_requests
+// have been served.
+func routes(parsed *vanity.Config, boot *BootstrapHandler, reached func(), serveMetrics bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/favicon.ico", NewStaticFile(static, "static/favicon.ico", "image/x-icon"))
+	mux.Handle("/robots.txt", robots(parsed))
+	mux.Handle("/healthz", http.HandlerFunc(healthz))
+	mux.Handle("/readyz", readyz(boot))
+
+	if serveMetrics {
+		mux.Handle("/metrics", http.HandlerFunc(metrics))
+	}
+
+	var paths http.Handler = boot
+	if parsed.MaxRequests > 0 {
+		paths = MaxRequestsHandler(uint64(parsed.MaxRequests), reached, boot)
+	}
+
+	mux.Handle("/", paths)
+
+	if parsed.CollapseSlash {
+		// The mux would redirect "//foo//bar" to "/foo/bar" before
+		// collapse_slashes serves the go command right away.
+		return SlashesHandler(mux, paths)
+	}
+
+	return mux
+}
+
+// load reads and parses the config, and returns the handler built from it
+// once self-tested, along with the handler serving requests. With a canary
+// overlay, the latter serves canary requests from the config overlaid with it.
+func (l loader) load() (*vanity.Config, *vanity.Handler, http.Handler, error) {
+	parsed, err := l.parse(l.path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	handler, err := l.build(parsed)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	serving, err := l.serving(parsed, handler)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return parsed, handler, serving, nil
+}
+
+// reload is like load, but builds the handler incrementally from current.
+func (l loader) reload(current *vanity.Handler) (*vanity.Handler, http.Handler, error) {
+	parsed, err := l.parse(l.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	handler, err := current.Reload(parsed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if l.selftest {
+		if err := handler.SelfTest(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	serving, err := l.serving(parsed, handler)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, nil, err
+	}
+
+	return handler, serving, nil
+}
+
+// serving returns the handler serving requests for the handler of parsed,
+// along with the canary overlay if any.
+func (l loader) serving(parsed *vanity.Config, handler *vanity.Handler) (http.Handler, error) {
+	if l.canary == "" {
+		return handler, nil
 	}
 
-	w.Header().Set("Content-Type", "image/x-icon")
-	_, _ = w.Write(f)
+	overlay, err := l.parse(l.canary)
+	if err != nil {
+		return nil, err
+	}
+
+	canary, err := l.build(parsed.Overlay(overlay))
+	if err != nil {
+		return nil, err
+	}
+
+	return vanity.CanaryHandler(handler, canary), nil
+}
+
+// parse reads and parses the config at path.
+func (l loader) parse(path string) (*vanity.Config, error) {
+	config, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return vanity.ParseConfigFormat(config, configFormat(path, l.format, config))
+}
+
+// build returns the handler of parsed, once self-tested if enabled.
+func (l loader) build(parsed *vanity.Config) (*vanity.Handler, error) {
+	handler, err := vanity.NewHandlerFromConfig(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.selftest {
+		if err := handler.SelfTest(); err != nil {
+			return nil, err
+		}
+	}
+
+	return handler, nil
+}
+
+// bootstrap retries loading the config every interval until it succeeds, then
+// sets the resulting handler on boot.
+func bootstrap(boot *BootstrapHandler, l loader, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		_, handler, serving, err := l.load()
+		if err != nil {
+			log.Printf("Loading %s: %v", l.path, err)
+			continue
+		}
+
+		active.Store(handler)
+		boot.Set(serving)
+		log.Printf("Loaded %s", l.path)
+
+		return
+	}
+}
+
+// reloads reloads the config on every signal received from hup, usually
+// SIGHUP, until it is closed.
+func reloads(hup <-chan os.Signal, boot *BootstrapHandler, l loader) {
+	for range hup {
+		reload(boot, l)
+	}
+}
+
+// reload reloads the config and swaps the handlers of boot for the new ones,
+// keeping the current ones if it fails. Server settings, e.g. TLS, are only
+// read at startup and not reloaded.
+func reload(boot *BootstrapHandler, l loader) {
+	if l.path == "-" {
+		log.Print("Can't reload the config from stdin, keeping the current config")
+		return
+	}
+
+	reloading.Lock()
+	defer reloading.Unlock()
+
+	current := active.Load()
+	if current == nil {
+		// Still bootstrapping, which loads the latest config anyway.
+		return
+	}
+
+	handler, serving, err := l.reload(current)
+	if err != nil {
+		log.Printf("Reloading %s: %v, keeping the current config", l.path, err)
+		return
+	}
+
+	active.Store(handler)
+	boot.Set(serving)
+	log.Printf("Reloaded %s", l.path)
+}
+
+// snapshots writes a snapshot of the hit counters of the active handler to
+// path on every SIGUSR1.
+func snapshots(path string) {
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+
+	for range usr1 {
+		h := active.Load()
+		if h == nil {
+			continue
+		}
+
+		if err := h.WriteSnapshot(path); err != nil {
+			log.Printf("Writing snapshot: %v", err)
+		}
+	}
+}
+
+// shutdown waits for a termination signal, then marks the servers as draining
+// and waits for delay before gracefully shutting them down. Connections still
+// open after drain are forcibly closed.
+func shutdown(sig <-chan os.Signal, delay, drain time.Duration, servers ...shutdowner) error {
+	s := <-sig
+	atomic.StoreInt32(&draining, 1)
+
+	log.Printf("Received %v, draining", s)
+
+	if delay > 0 {
+		log.Printf("Waiting %v before shutting down", delay)
+		time.Sleep(delay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+
+	for _, server := range servers {
+		err := server.Shutdown(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if s, ok := server.(*trackedServer); ok {
+			log.Printf("Drain timeout of %v exceeded, closing %d remaining connections", drain, s.open.Load())
+		} else {
+			log.Printf("Drain timeout of %v exceeded, closing the remaining connections", drain)
+		}
+
+		if err := server.Close(); err != nil {
+			return err
+		}
+	}
+
+	log.Print("Shutdown complete")
+
+	return nil
+}
+
+// defaultPort returns the port set by the PORT environment variable, which
+// most hosting platforms set, or 8080.
+func defaultPort() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return port
+	}
+
+	return "8080"
+}
+
+// tlsFiles sets the TLS certificate and key files of parsed from the
+// environment, then from the -tls-cert and -tls-key flags when set, and
+// checks that HTTP/3 is left with files to serve.
+func tlsFiles(parsed *vanity.Config, cert, key string) error {
+	if err := tlsFilesFromEnv(parsed); err != nil {
+		return err
+	}
+
+	if cert != "" {
+		parsed.TLSCertFile, parsed.TLSKeyFile = cert, key
+	}
+
+	if parsed.HTTP3 && parsed.TLSCertFile == "" {
+		return vanity.ErrHTTP3RequiresTLS
+	}
+
+	return nil
+}
+
+// tlsFilesFromEnv sets the TLS certificate and key files of parsed from the
+// TLS_CERT_FILE and TLS_KEY_FILE environment variables, when set.
+func tlsFilesFromEnv(parsed *vanity.Config) error {
+	cert, key := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+
+	switch {
+	case cert == "" && key == "":
+		return nil
+	case cert == "" || key == "":
+		return ErrTLSEnvIncomplete
+	}
+
+	parsed.TLSCertFile, parsed.TLSKeyFile = cert, key
+
+	return nil
+}
+
+// compressionFromEnv reports whether responses are gzipped, which can be
+// disabled with the COMPRESS_RESPONSES environment variable, e.g. when a
+// proxy in front already compresses them.
+func compressionFromEnv() (bool, error) {
+	v := os.Getenv("COMPRESS_RESPONSES")
+	if v == "" {
+		return true, nil
+	}
+
+	compress, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, ErrInvalidCompression
+	}
+
+	return compress, nil
+}
+
+// metrics serves the metrics of the active handler.
+func metrics(w http.ResponseWriter, r *http.Request) {
+	h := active.Load()
+	if h == nil {
+		http.Error(w, "bootstrapping", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = h.WriteMetrics(w)
+}
+
+// readyz returns the readiness check, failing while boot isn't ready or once
+// draining.
+func readyz(boot *BootstrapHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case atomic.LoadInt32(&draining) == 1:
+			http.Error(w, "draining", http.StatusServiceUnavailable)
+		case !boot.Ready():
+			http.Error(w, "bootstrapping", http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("ok"))
+		}
+	}
+}
+
+// healthz is the liveness check, failing once draining so that load
+// balancers checking it stop routing new traffic too.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&draining) == 1 {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
 }
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+	"github.com/quic-go/quic-go/http3"
+)
+
+type (
+	// fakeServer is a shutdowner that may hang until its context is done.
+	fakeServer struct {
+		hang   bool
+		closed bool
+	}
+)
+
+func (s *fakeServer) Shutdown(ctx context.Context) error {
+	if s.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+func (s *fakeServer) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	defer atomic.StoreInt32(&draining, 0)
+
+	graceful, hanging := &fakeServer{}, &fakeServer{hang: true}
+
+	sig := make(chan os.Signal, 1)
+	sig <- syscall.SIGTERM
+
+	if err := shutdown(sig, 0, 10*time.Millisecond, graceful, hanging); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	if graceful.closed {
+		t.Error("gracefully shut down server was closed")
+	}
+
+	if !hanging.closed {
+		t.Error("server still draining after drain timeout wasn't closed")
+	}
+
+	if atomic.LoadInt32(&draining) != 1 {
+		t.Error("draining not set")
+	}
+}
+
+func TestShutdownStopsAccepting(t *testing.T) {
+	defer atomic.StoreInt32(&draining, 0)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	boot := NewBootstrapHandler(0)
+	boot.Set(http.NotFoundHandler())
+
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", http.HandlerFunc(healthz))
+	mux.Handle("/readyz", readyz(boot))
+
+	server := &trackedServer{Server: &http.Server{Handler: mux, ReadHeaderTimeout: time.Second}}
+	server.ConnState = server.track
+
+	go func() { _ = server.Serve(ln) }()
+
+	url := "http://" + ln.Addr().String()
+
+	resp, err := http.Get(url + "/readyz")
+	if err != nil {
+		t.Fatalf("before shutdown: %v", err)
+	}
+
+	resp.Body.Close()
+
+	sig := make(chan os.Signal, 1)
+	sig <- syscall.SIGTERM
+
+	if err := shutdown(sig, 0, time.Second, server); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	if _, err := net.DialTimeout("tcp", ln.Addr().String(), time.Second); err == nil {
+		t.Error("connection accepted after shutdown")
+	}
+
+	// Load balancers are told to stop routing traffic by either check.
+	for path, want := range map[string]int{"/readyz": http.StatusServiceUnavailable, "/healthz": http.StatusServiceUnavailable} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if w.Code != want {
+			t.Errorf("after shutdown: %s status = %d; want %d", path, w.Code, want)
+		}
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	defer active.Store(nil)
+
+	path := filepath.Join(t.TempDir(), "vanity.yaml")
+	write := func(config string) {
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status := func(h http.Handler, path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?go-get=1", nil))
+
+		return w.Code
+	}
+
+	write("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n")
+
+	l := loader{path: path, selftest: true}
+
+	_, handler, serving, err := l.load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	boot := NewBootstrapHandler(time.Second)
+	active.Store(handler)
+	boot.Set(serving)
+
+	write("paths:\n  /gopdf:\n    repo: https://bitbucket.org/zombiezen/gopdf\n    vcs: hg\n")
+	reload(boot, l)
+
+	if got := status(boot, "/portmidi"); got != http.StatusNotFound {
+		t.Errorf("after reload: /portmidi status = %d; want %d", got, http.StatusNotFound)
+	}
+
+	if got := status(boot, "/gopdf"); got != http.StatusOK {
+		t.Errorf("after reload: /gopdf status = %d; want %d", got, http.StatusOK)
+	}
+
+	write("paths:\n  /portmidi:\n    repo: https://bitbucket.org/zombiezen/gopdf\n")
+	reload(boot, l)
+
+	if got := status(boot, "/gopdf"); got != http.StatusOK {
+		t.Errorf("after invalid reload: /gopdf status = %d; want %d", got, http.StatusOK)
+	}
+}
+
+func TestReloadKeepsCounters(t *testing.T) {
+	defer active.Store(nil)
+
+	path := filepath.Join(t.TempDir(), "vanity.yaml")
+	if err := os.WriteFile(path, []byte("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	l := loader{path: path, selftest: true}
+
+	_, handler, serving, err := l.load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	boot := NewBootstrapHandler(time.Second)
+	active.Store(handler)
+	boot.Set(serving)
+
+	for range 5 {
+		boot.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/portmidi?go-get=1", nil))
+	}
+
+	if err := os.WriteFile(path, []byte("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"+
+		"  /gopdf:\n    repo: https://github.com/zombiezen/gopdf\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reload(boot, l)
+
+	var metrics strings.Builder
+	if err := active.Load().WriteMetrics(&metrics); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+
+	// Neither the self-tests of the load nor of the reload count.
+	for _, want := range []string{
+		"govanityurls_requests_total 5\n",
+		`govanityurls_path_requests_total{path="/portmidi"} 5` + "\n",
+		`govanityurls_path_requests_total{path="/gopdf"} 0` + "\n",
+	} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Errorf("metrics after reload = %s; want %q", metrics.String(), want)
+		}
+	}
+}
+
+func TestReloads(t *testing.T) {
+	defer active.Store(nil)
+
+	path := filepath.Join(t.TempDir(), "vanity.yaml")
+	if err := os.WriteFile(path, []byte("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	l := loader{path: path, selftest: true}
+
+	_, handler, serving, err := l.load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	boot := NewBootstrapHandler(time.Second)
+	active.Store(handler)
+	boot.Set(serving)
+
+	hup := make(chan os.Signal)
+	done := make(chan struct{})
+
+	go func() {
+		reloads(hup, boot, l)
+		close(done)
+	}()
+
+	if err := os.WriteFile(path, []byte("paths:\n  /gopdf:\n    repo: https://github.com/zombiezen/gopdf\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// reloads returns once hup is closed, after handling the signal.
+	hup <- syscall.SIGHUP
+	close(hup)
+	<-done
+
+	if active.Load() == handler {
+		t.Fatal("handler not reloaded on SIGHUP")
+	}
+
+	w := httptest.NewRecorder()
+	boot.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gopdf?go-get=1", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("after SIGHUP: /gopdf status = %d; want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestTLSFilesFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		cert     string
+		key      string
+		wantCert string
+		wantKey  string
+		err      error
+	}{
+		{
+			name:     "unset",
+			wantCert: "config.crt",
+			wantKey:  "config.key",
+		},
+		{
+			name:     "both set",
+			cert:     "env.crt",
+			key:      "env.key",
+			wantCert: "env.crt",
+			wantKey:  "env.key",
+		},
+		{
+			name:     "cert only",
+			cert:     "env.crt",
+			wantCert: "config.crt",
+			wantKey:  "config.key",
+			err:      ErrTLSEnvIncomplete,
+		},
+	}
+	for _, test := range tests {
+		t.Setenv("TLS_CERT_FILE", test.cert)
+		t.Setenv("TLS_KEY_FILE", test.key)
+
+		parsed := &vanity.Config{TLSCertFile: "config.crt", TLSKeyFile: "config.key"}
+
+		if err := tlsFilesFromEnv(parsed); err != test.err {
+			t.Errorf("%s: err = %v; want %v", test.name, err, test.err)
+		}
+
+		if parsed.TLSCertFile != test.wantCert || parsed.TLSKeyFile != test.wantKey {
+			t.Errorf("%s: files = %q, %q; want %q, %q", test.name, parsed.TLSCertFile, parsed.TLSKeyFile, test.wantCert, test.wantKey)
+		}
+	}
+}
+
+func TestTLSFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   vanity.Config
+		env      bool
+		cert     string
+		key      string
+		wantCert string
+		err      error
+	}{
+		{
+			name:     "http3 with flags",
+			config:   vanity.Config{HTTP3: true},
+			cert:     "flag.crt",
+			key:      "flag.key",
+			wantCert: "flag.crt",
+		},
+		{
+			name:     "http3 with env",
+			config:   vanity.Config{HTTP3: true},
+			env:      true,
+			wantCert: "env.crt",
+		},
+		{
+			name:     "flags over env",
+			env:      true,
+			cert:     "flag.crt",
+			key:      "flag.key",
+			wantCert: "flag.crt",
+		},
+		{
+			name:   "http3 without files",
+			config: vanity.Config{HTTP3: true},
+			err:    vanity.ErrHTTP3RequiresTLS,
+		},
+	}
+	for _, test := range tests {
+		if test.env {
+			t.Setenv("TLS_CERT_FILE", "env.crt")
+			t.Setenv("TLS_KEY_FILE", "env.key")
+		} else {
+			t.Setenv("TLS_CERT_FILE", "")
+			t.Setenv("TLS_KEY_FILE", "")
+		}
+
+		parsed := test.config
+
+		if err := tlsFiles(&parsed, test.cert, test.key); !errors.Is(err, test.err) {
+			t.Errorf("%s: err = %v; want %v", test.name, err, test.err)
+		}
+
+		if parsed.TLSCertFile != test.wantCert {
+			t.Errorf("%s: cert = %q; want %q", test.name, parsed.TLSCertFile, test.wantCert)
+		}
+	}
+}
+
+func TestHTTP3(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer conn.Close()
+
+	cert, roots := selfSignedCert(t)
+
+	server := &trackedServer{Server: &http.Server{
+		Addr:    conn.LocalAddr().String(),
+		Handler: http.HandlerFunc(healthz),
+	}}
+
+	h3 := withHTTP3(server)
+	h3.TLSConfig = http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS13})
+
+	defer h3.Close()
+
+	go func() { _ = h3.Serve(conn) }()
+
+	// The header is only set once the HTTP/3 server listens.
+	port := strconv.Itoa(conn.LocalAddr().(*net.UDPAddr).Port)
+	want := `h3=":` + port + `"; ma=2592000`
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+		if got := w.Header().Get("Alt-Svc"); got == want {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("Alt-Svc = %q; want %q", got, want)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS13}}
+	defer transport.Close()
+
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+
+	resp, err := client.Get("https://127.0.0.1:" + port + "/healthz")
+	if err != nil {
+		t.Fatalf("GET over HTTP/3: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 3 {
+		t.Errorf("GET over HTTP/3 = %d %s; want %d HTTP/3.0", resp.StatusCode, resp.Proto, http.StatusOK)
+	}
+}
+
+// selfSignedCert returns a certificate for 127.0.0.1, along with the pool
+// trusting it.
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(parsed)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, roots
+}
+
+func TestRoutesCollapseSlashes(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		path     string
+		status   int
+		location string
+	}{
+		{
+			name:     "disabled",
+			path:     "//portmidi//sub?go-get=1",
+			status:   http.StatusTemporaryRedirect,
+			location: "/portmidi/sub?go-get=1",
+		},
+		{
+			name:   "go-get",
+			config: "collapse_slashes: true\n",
+			path:   "//portmidi//sub?go-get=1",
+			status: http.StatusOK,
+		},
+		{
+			name:     "browser",
+			config:   "collapse_slashes: true\n",
+			path:     "//portmidi//sub",
+			status:   http.StatusMovedPermanently,
+			location: "/portmidi/sub",
+		},
+		{
+			name:   "clean path",
+			config: "collapse_slashes: true\n",
+			path:   "/healthz",
+			status: http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		parsed, err := vanity.ParseConfig([]byte("host: example.com\n" + test.config +
+			"paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+		if err != nil {
+			t.Errorf("%s: ParseConfig: %v", test.name, err)
+			continue
+		}
+
+		handler, err := vanity.NewHandlerFromConfig(parsed)
+		if err != nil {
+			t.Errorf("%s: NewHandlerFromConfig: %v", test.name, err)
+			continue
+		}
+
+		boot := NewBootstrapHandler(time.Second)
+		boot.Set(handler)
+
+		w := httptest.NewRecorder()
+		routes(parsed, boot, func() {}, false).ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, test.status)
+		}
+
+		if got := w.Header().Get("Location"); got != test.location {
+			t.Errorf("%s: Location = %q; want %q", test.name, got, test.location)
+		}
+	}
+}
+
+func TestDefaultPort(t *testing.T) {
+	t.Setenv("PORT", "")
+
+	if got := defaultPort(); got != "8080" {
+		t.Errorf("defaultPort() = %q without PORT; want %q", got, "8080")
+	}
+
+	t.Setenv("PORT", "9000")
+
+	if got := defaultPort(); got != "9000" {
+		t.Errorf("defaultPort() = %q with PORT=9000; want %q", got, "9000")
+	}
+}
+
+func TestCompressionFromEnv(t *testing.T) {
+	tests := []struct {
+		value    string
+		compress bool
+		err      error
+	}{
+		{value: "", compress: true},
+		{value: "true", compress: true},
+		{value: "false", compress: false},
+		{value: "0", compress: false},
+		{value: "gzip", err: ErrInvalidCompression},
+	}
+
+	for _, test := range tests {
+		t.Setenv("COMPRESS_RESPONSES", test.value)
+
+		compress, err := compressionFromEnv()
+		if !errors.Is(err, test.err) {
+			t.Errorf("COMPRESS_RESPONSES=%q: err = %v; want %v", test.value, err, test.err)
+		}
+
+		if compress != test.compress {
+			t.Errorf("COMPRESS_RESPONSES=%q: compress = %t; want %t", test.value, compress, test.compress)
+		}
+	}
+}
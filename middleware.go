@@ -0,0 +1,297 @@
+package main
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+var (
+	// gzipWriters recycles the gzip writers of compressed responses, which
+	// are costly to allocate.
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+)
+
+const (
+	// hstsPreloadHeader is the Strict-Transport-Security value required by
+	// https://hstspreload.org.
+	hstsPreloadHeader = "max-age=63072000; includeSubDomains; preload"
+)
+
+type (
+	// hstsPreloadHandler is the http.Handler implementation for HSTSPreloadHandler.
+	hstsPreloadHandler struct {
+		handler http.Handler
+	}
+
+	// httpsRedirectHandler is the http.Handler implementation for
+	// HTTPSRedirectHandler.
+	httpsRedirectHandler struct {
+		handler http.Handler
+	}
+
+	// slashesHandler is the http.Handler implementation for SlashesHandler.
+	slashesHandler struct {
+		mux     http.Handler
+		handler http.Handler
+	}
+
+	// compressHandler is the http.Handler implementation for CompressHandler.
+	compressHandler struct {
+		handler http.Handler
+	}
+
+	// gzipResponseWriter compresses the response written through it once
+	// its headers show that it is worth compressing.
+	gzipResponseWriter struct {
+		http.ResponseWriter
+
+		zw          *gzip.Writer
+		wroteHeader bool
+	}
+
+	// altSvcHandler is the http.Handler implementation for AltSvcHandler.
+	altSvcHandler struct {
+		h3      *http3.Server
+		handler http.Handler
+	}
+
+	// maxRequestsHandler is the http.Handler implementation for
+	// MaxRequestsHandler.
+	maxRequestsHandler struct {
+		limit   uint64
+		served  *atomic.Uint64
+		reached func()
+		handler http.Handler
+	}
+)
+
+func (h hstsPreloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	exempt := isHealthCheck(r)
+
+	if !isHTTPS(r) {
+		if exempt {
+			h.handler.ServeHTTP(w, r)
+			return
+		}
+
+		// The preload list requires redirecting to HTTPS on the same host first.
+		http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusMovedPermanently)
+
+		return
+	}
+
+	w.Header().Set("Strict-Transport-Security", hstsPreloadHeader)
+
+	if apex := strings.TrimPrefix(r.Host, "www."); apex != r.Host && !exempt {
+		http.Redirect(w, r, "https://"+apex+r.URL.RequestURI(), http.StatusMovedPermanently)
+		return
+	}
+
+	h.handler.ServeHTTP(w, r)
+}
+
+// isHTTPS reports whether r was made over HTTPS, either directly or through a
+// TLS terminating proxy.
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// isHealthCheck reports whether r is a health check. Health checks are usually
+// made over plain HTTP from inside the network, so they are never redirected.
+func isHealthCheck(r *http.Request) bool {
+	return r.URL.Path == "/healthz" || r.URL.Path == "/readyz"
+}
+
+// HSTSPreloadHandler returns a http.Handler that wraps h and satisfies the HSTS
+// preload requirements: plain HTTP is redirected to HTTPS on the same host,
+// HTTPS responses carry the preload Strict-Transport-Security header and the
+// www subdomain is redirected to the apex domain.
+func HSTSPreloadHandler(h http.Handler) http.Handler {
+	return hstsPreloadHandler{h}
+}
+
+func (h httpsRedirectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if isHTTPS(r) || isHealthCheck(r) {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
+
+// HTTPSRedirectHandler returns a http.Handler that wraps h and permanently
+// redirects plain HTTP requests to HTTPS on the same host, keeping their path
+// and query, e.g. ?go-get=1.
+func HTTPSRedirectHandler(h http.Handler) http.Handler {
+	return httpsRedirectHandler{h}
+}
+
+func (h altSvcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_ = h.h3.SetQUICHeaders(w.Header())
+	h.handler.ServeHTTP(w, r)
+}
+
+// AltSvcHandler returns a http.Handler that wraps h and advertises the HTTP/3
+// server h3 through the Alt-Svc header, so that clients can upgrade.
+func AltSvcHandler(h3 *http3.Server, h http.Handler) http.Handler {
+	return altSvcHandler{h3, h}
+}
+
+func (h maxRequestsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+
+	if h.served.Add(1) == h.limit {
+		h.reached()
+	}
+}
+
+// MaxRequestsHandler returns a http.Handler that wraps h and calls reached
+// once, after limit requests have been served.
+func MaxRequestsHandler(limit uint64, reached func(), h http.Handler) http.Handler {
+	return maxRequestsHandler{limit, new(atomic.Uint64), reached, h}
+}
+
+func (h slashesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.URL.Path, "//") {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+// SlashesHandler returns a http.Handler that serves the requests for paths
+// with empty elements, e.g. "//foo//bar", with h rather than mux, which would
+// redirect them to the clean path.
+func SlashesHandler(mux, h http.Handler) http.Handler {
+	return slashesHandler{mux, h}
+}
+
+func (h compressHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	addVary(w.Header(), "Accept-Encoding")
+
+	if r.Method == http.MethodHead || !acceptsGzip(r) {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	gw := &gzipResponseWriter{ResponseWriter: w}
+	defer gw.close()
+
+	h.handler.ServeHTTP(gw, r)
+}
+
+// CompressHandler returns a http.Handler that wraps h and gzips the responses
+// with a compressible content type for clients accepting it. Responses that
+// are already encoded, e.g. precompressed static files, are left as is.
+func CompressHandler(h http.Handler) http.Handler {
+	return compressHandler{h}
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+
+	w.wroteHeader = true
+
+	if compressible(status, w.Header()) {
+		w.Header().Del("Content-Length")
+		w.Header().Set("Content-Encoding", "gzip")
+
+		w.zw = gzipWriters.Get().(*gzip.Writer)
+		w.zw.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.zw != nil {
+		return w.zw.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *gzipResponseWriter) Flush() {
+	if w.zw != nil {
+		_ = w.zw.Flush()
+	}
+
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close terminates the compressed stream, if any.
+func (w *gzipResponseWriter) close() {
+	if w.zw == nil {
+		return
+	}
+
+	_ = w.zw.Close()
+	w.zw.Reset(nil)
+	gzipWriters.Put(w.zw)
+	w.zw = nil
+}
+
+// compressible reports whether a response with status and header is worth
+// compressing: it has a body, isn't already encoded and is made of text.
+func compressible(status int, header http.Header) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+
+	return false
+}
+
+// addVary adds value to the Vary header unless it's already listed.
+func addVary(header http.Header, value string) {
+	for _, v := range header.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) {
+				return
+			}
+		}
+	}
+
+	header.Add("Vary", value)
+}
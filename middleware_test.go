@@ -0,0 +1,258 @@
+package main
+
+import (
+	"cmp"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestHSTSPreloadHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		proto    string
+		status   int
+		location string
+		hsts     string
+	}{
+		{
+			name:     "http to https on the same host",
+			url:      "http://www.example.com/portmidi?go-get=1",
+			status:   http.StatusMovedPermanently,
+			location: "https://www.example.com/portmidi?go-get=1",
+		},
+		{
+			name:     "www to apex",
+			url:      "http://www.example.com/portmidi",
+			proto:    "https",
+			status:   http.StatusMovedPermanently,
+			location: "https://example.com/portmidi",
+			hsts:     hstsPreloadHeader,
+		},
+		{
+			name:   "apex",
+			url:    "http://example.com/portmidi",
+			proto:  "https",
+			status: http.StatusOK,
+			hsts:   hstsPreloadHeader,
+		},
+		{
+			name:   "health check over http",
+			url:    "http://www.example.com/healthz",
+			status: http.StatusOK,
+		},
+	}
+
+	h := HSTSPreloadHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.url, nil)
+		if test.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", test.proto)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, test.status)
+		}
+
+		if got := w.Header().Get("Location"); got != test.location {
+			t.Errorf("%s: Location = %q; want %q", test.name, got, test.location)
+		}
+
+		if got := w.Header().Get("Strict-Transport-Security"); got != test.hsts {
+			t.Errorf("%s: Strict-Transport-Security = %q; want %q", test.name, got, test.hsts)
+		}
+	}
+}
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		proto    string
+		status   int
+		location string
+	}{
+		{
+			name:     "http",
+			url:      "http://go.example.com/mymod?go-get=1",
+			status:   http.StatusMovedPermanently,
+			location: "https://go.example.com/mymod?go-get=1",
+		},
+		{
+			name:   "https",
+			url:    "https://go.example.com/mymod?go-get=1",
+			status: http.StatusOK,
+		},
+		{
+			name:   "https through a proxy",
+			url:    "http://go.example.com/mymod?go-get=1",
+			proto:  "https",
+			status: http.StatusOK,
+		},
+		{
+			name:   "health check over http",
+			url:    "http://go.example.com/readyz",
+			status: http.StatusOK,
+		},
+	}
+
+	h := HTTPSRedirectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.url, nil)
+		if test.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", test.proto)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, test.status)
+		}
+
+		if got := w.Header().Get("Location"); got != test.location {
+			t.Errorf("%s: Location = %q; want %q", test.name, got, test.location)
+		}
+	}
+}
+
+func TestCompressHandler(t *testing.T) {
+	const body = "<!DOCTYPE html><html><body>portmidi</body></html>"
+
+	tests := []struct {
+		name        string
+		method      string
+		accept      string
+		contentType string
+		encoding    string
+		status      int
+		gzipped     bool
+	}{
+		{
+			name:        "html",
+			accept:      "gzip, deflate, br",
+			contentType: "text/html; charset=utf-8",
+			gzipped:     true,
+		},
+		{
+			name:    "sniffed content type",
+			accept:  "gzip",
+			gzipped: true,
+		},
+		{
+			name:        "gzip not accepted",
+			accept:      "br",
+			contentType: "text/html; charset=utf-8",
+		},
+		{
+			name:        "binary",
+			accept:      "gzip",
+			contentType: "image/x-icon",
+		},
+		{
+			name:        "already encoded",
+			accept:      "gzip",
+			contentType: "text/html; charset=utf-8",
+			encoding:    "gzip",
+		},
+		{
+			name:        "not modified",
+			accept:      "gzip",
+			contentType: "text/html; charset=utf-8",
+			status:      http.StatusNotModified,
+		},
+		{
+			name:        "head",
+			method:      http.MethodHead,
+			accept:      "gzip",
+			contentType: "text/html; charset=utf-8",
+		},
+	}
+
+	for _, test := range tests {
+		h := CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if test.contentType != "" {
+				w.Header().Set("Content-Type", test.contentType)
+			}
+
+			if test.encoding != "" {
+				w.Header().Set("Content-Encoding", test.encoding)
+				addVary(w.Header(), "Accept-Encoding")
+			}
+
+			if test.status != 0 {
+				w.WriteHeader(test.status)
+				return
+			}
+
+			_, _ = io.WriteString(w, body)
+		}))
+
+		r := httptest.NewRequest(cmp.Or(test.method, http.MethodGet), "/portmidi", nil)
+		r.Header.Set("Accept-Encoding", test.accept)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if got := w.Header().Values("Vary"); len(got) != 1 || got[0] != "Accept-Encoding" {
+			t.Errorf("%s: Vary = %q; want [Accept-Encoding]", test.name, got)
+		}
+
+		encoding := w.Header().Get("Content-Encoding")
+
+		if !test.gzipped {
+			if encoding != test.encoding {
+				t.Errorf("%s: Content-Encoding = %q; want %q", test.name, encoding, test.encoding)
+			}
+
+			continue
+		}
+
+		if encoding != "gzip" {
+			t.Errorf("%s: Content-Encoding = %q; want gzip", test.name, encoding)
+			continue
+		}
+
+		zr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if got, err := io.ReadAll(zr); err != nil || string(got) != body {
+			t.Errorf("%s: body = %q, %v; want %q", test.name, got, err, body)
+		}
+	}
+}
+
+func TestMaxRequestsHandler(t *testing.T) {
+	var reached int
+
+	h := MaxRequestsHandler(10, func() { reached++ }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var wg sync.WaitGroup
+
+	for range 15 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/portmidi", nil))
+		}()
+	}
+
+	wg.Wait()
+
+	if reached != 1 {
+		t.Errorf("reached called %d times; want 1", reached)
+	}
+}
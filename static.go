@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+)
+
+const (
+	// staticCacheControl lets browsers cache static files for a day, rather
+	// than fetching them along every page.
+	staticCacheControl = "public, max-age=86400"
+
+	// robotsContentType is the Content-Type of /robots.txt.
+	robotsContentType = "text/plain; charset=utf-8"
+)
+
+type (
+	// StaticFile serves a file read once from a file system, along with its
+	// gzip compressed variant for clients that support it.
+	StaticFile struct {
+		contentType string
+		raw         []byte
+		gzipped     []byte
+		err         error
+	}
+)
+
+func (f *StaticFile) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.err != nil {
+		http.Error(w, f.err.Error(), http.StatusNotFound)
+		return
+	}
+
+	body := f.raw
+
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Set("Cache-Control", staticCacheControl)
+	addVary(w.Header(), "Accept-Encoding")
+
+	if f.gzipped != nil && acceptsGzip(r) {
+		body = f.gzipped
+
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	_, _ = w.Write(body)
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of r allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.TrimSpace(name) != "gzip" {
+			continue
+		}
+
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+
+		return !ok || strings.Trim(q, "0.") != ""
+	}
+
+	return false
+}
+
+// NewStaticFile reads the file name from fsys and precompresses it. The
+// compressed variant is only kept when it is smaller than the original.
+func NewStaticFile(fsys fs.FS, name, contentType string) *StaticFile {
+	raw, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return &StaticFile{contentType: contentType, err: err}
+	}
+
+	return NewStaticContent(raw, contentType)
+}
+
+// NewStaticContent is NewStaticFile for content already in memory.
+func NewStaticContent(raw []byte, contentType string) *StaticFile {
+	f := &StaticFile{contentType: contentType, raw: raw}
+
+	var buf bytes.Buffer
+
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	_, _ = zw.Write(f.raw)
+
+	if err := zw.Close(); err == nil && buf.Len() < len(f.raw) {
+		f.gzipped = buf.Bytes()
+	}
+
+	return f
+}
+
+// robots returns the /robots.txt of parsed, disallowing every crawler unless
+// robots_txt is set. The go command doesn't read it, so it never affects
+// go get.
+func robots(parsed *vanity.Config) *StaticFile {
+	if parsed.RobotsTxt != "" {
+		return NewStaticContent([]byte(parsed.RobotsTxt), robotsContentType)
+	}
+
+	return NewStaticFile(static, "static/robots.txt", robotsContentType)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+)
+
+func TestStaticFile(t *testing.T) {
+	raw, err := static.ReadFile("static/favicon.ico")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		gzipped        bool
+	}{
+		{name: "identity"},
+		{name: "gzip", acceptEncoding: "deflate, gzip;q=0.8", gzipped: true},
+		{name: "gzip refused", acceptEncoding: "gzip;q=0"},
+	}
+
+	f := NewStaticFile(static, "static/favicon.ico", "image/x-icon")
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/favicon.ico", nil)
+		r.Header.Set("Accept-Encoding", test.acceptEncoding)
+
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, http.StatusOK)
+		}
+
+		if got := w.Header().Get("Content-Type"); got != "image/x-icon" {
+			t.Errorf("%s: Content-Type = %q; want %q", test.name, got, "image/x-icon")
+		}
+
+		if got := w.Header().Get("Cache-Control"); got != staticCacheControl {
+			t.Errorf("%s: Cache-Control = %q; want %q", test.name, got, staticCacheControl)
+		}
+
+		var body io.Reader = w.Body
+
+		if got := w.Header().Get("Content-Encoding") == "gzip"; got != test.gzipped {
+			t.Fatalf("%s: gzipped = %v; want %v", test.name, got, test.gzipped)
+		}
+
+		if test.gzipped {
+			if body, err = gzip.NewReader(w.Body); err != nil {
+				t.Fatalf("%s: gzip.NewReader: %v", test.name, err)
+			}
+		}
+
+		if got, err := io.ReadAll(body); err != nil || string(got) != string(raw) {
+			t.Errorf("%s: body differs from static/favicon.ico (err: %v)", test.name, err)
+		}
+	}
+}
+
+func TestStaticFileMissing(t *testing.T) {
+	f := NewStaticFile(static, "static/missing.ico", "image/x-icon")
+
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusNotFound)
+	}
+
+	if got := w.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q; want the plain text error", got)
+	}
+
+	if got := w.Header().Get("Cache-Control"); got != "" {
+		t.Errorf("Cache-Control = %q; want none", got)
+	}
+}
+
+func TestRobots(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{
+			name: "default",
+			want: "User-agent: *\nDisallow: /\n",
+		},
+		{
+			name:   "configured",
+			config: "User-agent: *\nAllow: /\n",
+			want:   "User-agent: *\nAllow: /\n",
+		},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		robots(&vanity.Config{RobotsTxt: test.config}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, http.StatusOK)
+		}
+
+		if got := w.Header().Get("Content-Type"); got != robotsContentType {
+			t.Errorf("%s: Content-Type = %q; want %q", test.name, got, robotsContentType)
+		}
+
+		if got := w.Body.String(); got != test.want {
+			t.Errorf("%s: body = %q; want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+)
+
+// reportPaths writes a summary of the paths of pset to w for -validate, one
+// path per line with its VCS and repo.
+func reportPaths(w io.Writer, pset vanity.PathConfigSet) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	for _, pc := range pset {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", pc.Path, pc.VCS, pc.Repo)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%d paths\n", len(pset))
+
+	return err
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+)
+
+func TestReportPaths(t *testing.T) {
+	h, err := vanity.NewHandler([]byte("paths:\n" +
+		"  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n" +
+		"  /launchpad:\n    repo: https://hg.example.com/launchpad\n    vcs: hg\n"))
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := reportPaths(&buf, h.PathConfigs()); err != nil {
+		t.Fatalf("reportPaths: %v", err)
+	}
+
+	want := "/launchpad  hg   https://hg.example.com/launchpad\n" +
+		"/portmidi   git  https://github.com/rakyll/portmidi\n" +
+		"2 paths\n"
+	if got := buf.String(); got != want {
+		t.Errorf("reportPaths =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package vanity
+
+import (
+	"net/http"
+	"strings"
+)
+
+type (
+	// canaryHandler is the http.Handler implementation for CanaryHandler.
+	canaryHandler struct {
+		primary http.Handler
+		canary  http.Handler
+	}
+)
+
+func (h canaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "X-Vanity-Canary")
+
+	if r.Header.Get("X-Vanity-Canary") != "1" {
+		h.primary.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("X-Vanity-Canary", "1")
+	h.canary.ServeHTTP(w, r)
+}
+
+// CanaryHandler returns a http.Handler serving requests with the
+// X-Vanity-Canary: 1 header from canary, and any other from primary.
+func CanaryHandler(primary, canary http.Handler) http.Handler {
+	return canaryHandler{primary, canary}
+}
+
+// Overlay returns a copy of c with the paths of o layered on top: they
+// replace the paths of c configured with the same path, and add to the
+// others. Any other setting of o is ignored.
+func (c *Config) Overlay(o *Config) *Config {
+	overlaid := *c
+	overlaid.Paths = nil
+
+	replaced := make(map[string]bool, len(o.Paths))
+	for _, e := range o.Paths {
+		replaced[strings.TrimSuffix(e.Path, "/")] = true
+	}
+
+	for _, e := range c.Paths {
+		if !replaced[strings.TrimSuffix(e.Path, "/")] {
+			overlaid.Paths = append(overlaid.Paths, e)
+		}
+	}
+
+	overlaid.Paths = append(overlaid.Paths, o.Paths...)
+
+	return &overlaid
+}
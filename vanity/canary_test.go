@@ -0,0 +1,70 @@
+package vanity
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCanaryHandler(t *testing.T) {
+	primary, err := ParseConfig([]byte("host: example.com\npaths:\n" +
+		"  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n" +
+		"  /moved/:\n    repo: https://github.com/example/old\n"))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+
+	overlay, err := ParseConfig([]byte("paths:\n" +
+		"  /moved:\n    repo: https://github.com/example/new\n" +
+		"  /new:\n    repo: https://github.com/example/new\n"))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+
+	ph, err := NewHandlerFromConfig(primary)
+	if err != nil {
+		t.Fatalf("NewHandlerFromConfig: %v", err)
+	}
+
+	ch, err := NewHandlerFromConfig(primary.Overlay(overlay))
+	if err != nil {
+		t.Fatalf("NewHandlerFromConfig(overlay): %v", err)
+	}
+
+	h := CanaryHandler(ph, ch)
+
+	tests := []struct {
+		path     string
+		canary   bool
+		status   int
+		goImport string
+	}{
+		{"/portmidi", false, http.StatusOK, "example.com/portmidi git https://github.com/rakyll/portmidi"},
+		{"/portmidi", true, http.StatusOK, "example.com/portmidi git https://github.com/rakyll/portmidi"},
+		{"/moved", false, http.StatusOK, "example.com/moved git https://github.com/example/old"},
+		{"/moved", true, http.StatusOK, "example.com/moved git https://github.com/example/new"},
+		{"/new", false, http.StatusNotFound, ""},
+		{"/new", true, http.StatusOK, "example.com/new git https://github.com/example/new"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.path+"?go-get=1", nil)
+		if test.canary {
+			r.Header.Set("X-Vanity-Canary", "1")
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s (canary %v): status = %d; want %d", test.path, test.canary, w.Code, test.status)
+		}
+
+		if got := findMeta(w.Body.Bytes(), "go-import"); got != test.goImport {
+			t.Errorf("%s (canary %v): meta go-import = %q; want %q", test.path, test.canary, got, test.goImport)
+		}
+
+		if got := w.Header().Get("Vary"); got != "X-Vanity-Canary" {
+			t.Errorf("%s (canary %v): Vary = %q; want X-Vanity-Canary", test.path, test.canary, got)
+		}
+	}
+}
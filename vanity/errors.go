@@ -0,0 +1,218 @@
+package vanity
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidConfig           = errors.New("invalid config")
+	ErrInvalidConfigFormat     = errors.New("config format must be yaml, json or toml")
+	ErrCacheMaxAgeNegative     = errors.New("cache-max-age must be positive")
+	ErrInvalidImportHost       = errors.New("import_host must be a host, without scheme nor path")
+	ErrInvalidGodocHost        = errors.New("godoc_host must be a host, without scheme nor path")
+	ErrShutdownDelayNegative   = errors.New("shutdown_delay must be positive")
+	ErrDrainTimeoutNegative    = errors.New("drain_timeout must be positive")
+	ErrIndexPageSizeNegative   = errors.New("index_page_size must be positive")
+	ErrInvalidPage             = errors.New("page and per_page must be positive integers")
+	ErrMaxRequestsNegative     = errors.New("max_requests must be positive")
+	ErrConnLimitNegative       = errors.New("read_timeout, conn_max_age and max_conns_per_ip must be positive")
+	ErrTLSIncomplete           = errors.New("tls_cert_file and tls_key_file must be set together")
+	ErrHTTP3RequiresTLS        = errors.New("http3 requires TLS certificate files")
+	ErrInvalidIndexGroupBy     = errors.New("index_group_by must be one of none, provider or org")
+	ErrKeepAlivePeriodNegative = errors.New("keepalive period must be positive")
+	ErrInvalidIndexPath        = errors.New("index_path must start with /")
+	ErrRootModuleConflict      = errors.New("root_module cannot be combined with the / path")
+	ErrInvalidIndexRedirect    = errors.New("index_redirect must be an absolute http(s) URL")
+	ErrInvalidSubpathSeparator = errors.New("subpath_separator cannot contain /, @, ? or #")
+	ErrPathMissing             = errors.New("path is required for every entry of the paths list")
+	ErrInvalidRootBehavior     = errors.New("root_behavior must be one of index, vanity or redirect")
+	ErrInvalidUnknownQuery     = errors.New("unknown_query must be one of ignore, redirect or reject")
+	ErrInvalidBrowseTarget     = errors.New("browse_target must be one of docs, index or repo")
+	ErrHTTPHostMissing         = errors.New("host is required")
+	ErrUnableToRender          = errors.New("error rendering HTTP response")
+	ErrGoImportMissing         = errors.New(`the template must render a <meta name="go-import"> tag`)
+)
+
+type (
+	InvalidVCSError struct {
+		path string
+		repo string
+	}
+
+	InvalidSourceRepoError struct {
+		path string
+		repo string
+	}
+
+	InvalidProviderPrefixError struct {
+		prefix string
+		host   string
+	}
+
+	InvalidNegativeMaxAgeError struct {
+		prefix string
+		age    int64
+	}
+
+	InvalidCacheMaxAgeError struct {
+		path string
+		age  int64
+	}
+
+	InvalidWildcardError struct {
+		path string
+	}
+
+	DuplicatePathError struct {
+		path  string
+		first string
+	}
+
+	InvalidBodyTemplateError struct {
+		err error
+	}
+
+	InvalidErrorTemplateError struct {
+		err error
+	}
+
+	InvalidTemplateFileError struct {
+		setting string
+		err     error
+	}
+
+	InvalidDisplayTemplateError struct {
+		path string
+		err  error
+	}
+
+	InvalidTLSSettingError struct {
+		setting string
+		value   string
+	}
+
+	InvalidTrustedProxyError struct {
+		proxy string
+	}
+)
+
+func (e *InvalidVCSError) Error() string {
+	return fmt.Sprintf("configuration for %v: cannot infer VCS from %s", e.path, e.repo)
+}
+
+func NewInvalidVCSError(path, repo string) error {
+	return &InvalidVCSError{path, repo}
+}
+
+func (e *InvalidSourceRepoError) Error() string {
+	return fmt.Sprintf("configuration for %v: source_repo %s is not an absolute http(s) URL", e.path, e.repo)
+}
+
+func NewInvalidSourceRepoError(path, repo string) error {
+	return &InvalidSourceRepoError{path, repo}
+}
+
+func (e *InvalidProviderPrefixError) Error() string {
+	return fmt.Sprintf("provider_prefix_mode: invalid prefix %q for host %q", e.prefix, e.host)
+}
+
+func NewInvalidProviderPrefixError(prefix, host string) error {
+	return &InvalidProviderPrefixError{prefix, host}
+}
+
+func (e *InvalidNegativeMaxAgeError) Error() string {
+	return fmt.Sprintf("negative_max_age: invalid max age %d for prefix %q", e.age, e.prefix)
+}
+
+func NewInvalidNegativeMaxAgeError(prefix string, age int64) error {
+	return &InvalidNegativeMaxAgeError{prefix, age}
+}
+
+func (e *InvalidCacheMaxAgeError) Error() string {
+	return fmt.Sprintf("configuration for %v: cache_max_age %d must be positive", e.path, e.age)
+}
+
+func NewInvalidCacheMaxAgeError(path string, age int64) error {
+	return &InvalidCacheMaxAgeError{path, age}
+}
+
+func (e *InvalidWildcardError) Error() string {
+	return fmt.Sprintf("configuration for %v: * must be the last element of the path, e.g. /x/*", e.path)
+}
+
+func NewInvalidWildcardError(path string) error {
+	return &InvalidWildcardError{path}
+}
+
+func (e *DuplicatePathError) Error() string {
+	return fmt.Sprintf("configuration for %v: same path as %v", e.path, e.first)
+}
+
+func NewDuplicatePathError(path, first string) error {
+	return &DuplicatePathError{path, first}
+}
+
+func (e *InvalidBodyTemplateError) Error() string {
+	return fmt.Sprintf("body_template: %v", e.err)
+}
+
+func (e *InvalidBodyTemplateError) Unwrap() error {
+	return e.err
+}
+
+func NewInvalidBodyTemplateError(err error) error {
+	return &InvalidBodyTemplateError{err}
+}
+
+func (e *InvalidErrorTemplateError) Error() string {
+	return fmt.Sprintf("error_template: %v", e.err)
+}
+
+func (e *InvalidErrorTemplateError) Unwrap() error {
+	return e.err
+}
+
+func NewInvalidErrorTemplateError(err error) error {
+	return &InvalidErrorTemplateError{err}
+}
+
+func (e *InvalidTemplateFileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.setting, e.err)
+}
+
+func (e *InvalidTemplateFileError) Unwrap() error {
+	return e.err
+}
+
+func NewInvalidTemplateFileError(setting string, err error) error {
+	return &InvalidTemplateFileError{setting, err}
+}
+
+func (e *InvalidDisplayTemplateError) Error() string {
+	return fmt.Sprintf("configuration for %v: display_template: %v", e.path, e.err)
+}
+
+func (e *InvalidDisplayTemplateError) Unwrap() error {
+	return e.err
+}
+
+func NewInvalidDisplayTemplateError(path string, err error) error {
+	return &InvalidDisplayTemplateError{path, err}
+}
+
+func (e *InvalidTLSSettingError) Error() string {
+	return fmt.Sprintf("tls: unknown or insecure %s %q", e.setting, e.value)
+}
+
+func NewInvalidTLSSettingError(setting, value string) error {
+	return &InvalidTLSSettingError{setting, value}
+}
+
+func (e *InvalidTrustedProxyError) Error() string {
+	return fmt.Sprintf("trusted_proxies: %q is not a CIDR nor an IP", e.proxy)
+}
+
+func NewInvalidTrustedProxyError(proxy string) error {
+	return &InvalidTrustedProxyError{proxy}
+}
@@ -0,0 +1,87 @@
+package vanity
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+var (
+	// templateFuncs are the functions available to the index and vanity
+	// templates. They are limited to side-effect free string helpers, with
+	// the argument being transformed last so that they can be pipelined, e.g.
+	// {{.Import | trimPrefix "example.com/" | upper}}.
+	templateFuncs = map[string]any{
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"trimSpace":  strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       func(sep string, elems []string) string { return strings.Join(elems, sep) },
+		"default":    defaultString,
+	}
+)
+
+type (
+	// pageTemplate is implemented by both html/template and text/template
+	// templates, so that pages of any format are executed alike.
+	pageTemplate interface {
+		Execute(w io.Writer, data any) error
+	}
+)
+
+// defaultString returns s, or def when s is empty.
+func defaultString(def, s string) string {
+	if s == "" {
+		return def
+	}
+
+	return s
+}
+
+// parseTemplate parses the named embedded HTML template with templateFuncs.
+func parseTemplate(name string) *template.Template {
+	return template.Must(template.New(name).Funcs(templateFuncs).ParseFS(templates, "templates/"+name))
+}
+
+// parseTemplateFile parses the HTML template in the file at path with
+// templateFuncs.
+func parseTemplateFile(path string) (*template.Template, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return template.New(filepath.Base(path)).Funcs(templateFuncs).Parse(string(b))
+}
+
+// parseTextTemplate parses the named embedded template with templateFuncs,
+// without the HTML escaping that would garble the formats other than HTML.
+func parseTextTemplate(name string) *texttemplate.Template {
+	return texttemplate.Must(texttemplate.New(name).Funcs(templateFuncs).ParseFS(templates, "templates/"+name))
+}
+
+// executeText parses the text template text with templateFuncs, and returns
+// its output for data.
+func executeText(name, text string, data any) (string, error) {
+	tmpl, err := texttemplate.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
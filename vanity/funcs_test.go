@@ -0,0 +1,44 @@
+package vanity
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{`{{"Example.com/Foo" | lower}}`, "example.com/foo"},
+		{`{{"foo" | upper}}`, "FOO"},
+		{`{{" foo " | trimSpace}}`, "foo"},
+		{`{{"example.com/foo" | trimPrefix "example.com/"}}`, "foo"},
+		{`{{"foo.git" | trimSuffix ".git"}}`, "foo"},
+		{`{{if "https://github.com/foo" | hasPrefix "https://github.com/"}}yes{{end}}`, "yes"},
+		{`{{if "foo.git" | hasSuffix ".git"}}yes{{end}}`, "yes"},
+		{`{{if "foo/bar" | contains "/"}}yes{{end}}`, "yes"},
+		{`{{"a/b/c" | replace "/" "-"}}`, "a-b-c"},
+		{`{{"a/b/c" | split "/" | join ", "}}`, "a, b, c"},
+		{`{{"" | default "none"}}`, "none"},
+		{`{{"foo" | default "none"}}`, "foo"},
+	}
+	for _, test := range tests {
+		tmpl, err := template.New("test").Funcs(templateFuncs).Parse(test.tmpl)
+		if err != nil {
+			t.Errorf("%s: parse: %v", test.tmpl, err)
+			continue
+		}
+
+		var b strings.Builder
+		if err := tmpl.Execute(&b, nil); err != nil {
+			t.Errorf("%s: execute: %v", test.tmpl, err)
+			continue
+		}
+
+		if got := b.String(); got != test.want {
+			t.Errorf("%s = %q; want %q", test.tmpl, got, test.want)
+		}
+	}
+}
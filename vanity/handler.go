@@ -0,0 +1,1735 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vanity serves Go vanity URLs. A Handler built from a Config is an
+// http.Handler, to be mounted on any server; the govanityurls command is a
+// thin wrapper serving one.
+package vanity
+
+import (
+	"bytes"
+	"cmp"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// defaultBodyTemplate is the vanity page body shown to browsers.
+	defaultBodyTemplate = `Redirecting to <a href="{{.Repo}}">{{.Repo}}</a> ...`
+
+	// indexMaxPageSize caps the per_page query parameter of a paginated
+	// index, unless index_page_size is larger.
+	indexMaxPageSize = 1000
+)
+
+var (
+	//go:embed templates
+	templates embed.FS
+
+	providerRules = []providerRule{
+		{
+			name:   "github",
+			prefix: "https://github.com/",
+			vcs:    "git",
+			branch: "master",
+			dir:    "{repo}/tree/{branch}{/dir}",
+			file:   "{repo}/blob/{branch}{/dir}/{file}#L{line}",
+		},
+		{
+			name:   "bitbucket",
+			prefix: "https://bitbucket.org",
+			branch: "default",
+			dir:    "{repo}/src/{branch}{/dir}",
+			file:   "{repo}/src/{branch}{/dir}/{file}#{file}-{line}",
+		},
+		{
+			// Self-hosted GitLab instances can't be told apart from other
+			// hosts, so they need an explicit vcs.
+			name:   "gitlab",
+			prefix: "https://gitlab.com/",
+			vcs:    "git",
+			branch: "master",
+			dir:    "{repo}/-/tree/{branch}{/dir}",
+			file:   "{repo}/-/blob/{branch}{/dir}/{file}#L{line}",
+		},
+		{
+			// Codeberg runs Forgejo, a Gitea fork. Files link to the source
+			// view, as the raw view has no line anchors.
+			name:   "codeberg",
+			prefix: "https://codeberg.org/",
+			vcs:    "git",
+			branch: "master",
+			dir:    "{repo}/src/branch/{branch}{/dir}",
+			file:   "{repo}/src/branch/{branch}{/dir}/{file}#L{line}",
+		},
+		{
+			name:   "sourcehut",
+			prefix: "https://git.sr.ht/",
+			vcs:    "git",
+			branch: "master",
+			dir:    "{repo}/tree/{branch}/item{/dir}",
+			file:   "{repo}/tree/{branch}/item{/dir}/{file}#L{line}",
+		},
+		{
+			// Mercurial repos on SourceHut browse revisions through a query.
+			name:   "sourcehut",
+			prefix: "https://hg.sr.ht/",
+			vcs:    "hg",
+			branch: "tip",
+			dir:    "{repo}/browse{/dir}?rev={branch}",
+			file:   "{repo}/browse{/dir}/{file}?rev={branch}#L{line}",
+		},
+	}
+)
+
+type (
+	// Handler serves the vanity pages and index of a Config.
+	Handler struct {
+		host          string
+		importHost    string
+		config        *Config
+		paths         PathConfigSet
+		cachectrl     string
+		debugHeaders  bool
+		showHits      bool
+		suggestCase   bool
+		attribution   bool
+		docsRedirect  bool
+		godocHost     string
+		indexGroupBy  string
+		indexPageSize int
+		indexPath     string
+		wildcards     []wildcardPath
+		indexRedirect string
+		rootBehavior  string
+		unknownQuery  string
+		body          *template.Template
+		indexPages    map[string]pageTemplate
+		vanityPage    *template.Template
+		errorPage     *template.Template
+		traceContext  bool
+		separator     string
+		goGetOnly     bool
+		browseTarget  string
+		collapseSlash bool
+
+		// notFoundCachectrl holds the Cache-Control value of 404 responses
+		// for paths under each prefix of NegativeMaxAge.
+		notFoundCachectrl map[string]string
+
+		// hits counts the requests served by each configured path since
+		// started, keyed by PathConfig.Path. The map itself is never modified
+		// after construction.
+		hits    map[string]*atomic.Uint64
+		started time.Time
+
+		// requests and misses count every request and those not matching
+		// any path. Like hits, they are kept across reloads.
+		requests *atomic.Uint64
+		misses   *atomic.Uint64
+
+		// latency is the distribution of the time taken by ServeHTTP, also
+		// kept across reloads.
+		latency *histogram
+	}
+
+	PathConfigSet []PathConfig
+
+	PathConfig struct {
+		Path    string
+		Repo    string
+		Display string
+		VCS     string
+
+		// Priority breaks ties between paths configured more than once, the
+		// lowest first. It is the position of paths given as a list.
+		Priority int
+
+		// CacheControl overrides the Cache-Control header of the handler
+		// when set.
+		CacheControl string
+	}
+
+	VanityTemplate struct {
+		Import  string
+		SubPath string
+		Repo    string
+		Display string
+		VCS     string
+
+		// GoGet is set for requests made by the go command, which only reads
+		// the go-import and go-source meta tags.
+		GoGet bool
+
+		// Body is the rendered body_template.
+		Body template.HTML
+	}
+
+	// DisplayTemplate is the data of display_template.
+	DisplayTemplate struct {
+		Repo   string
+		Branch string
+		Import string
+		Host   string
+	}
+
+	// ErrorTemplate is the data of the error page.
+	ErrorTemplate struct {
+		Status     int
+		StatusText string
+		Error      string
+
+		// RequestID is the trace ID of the request, when trace_context is
+		// enabled.
+		RequestID string
+	}
+
+	IndexTemplate struct {
+		Host        string
+		Handlers    []IndexHandler
+		Groups      []IndexGroup
+		ShowHits    bool
+		Attribution bool
+
+		// Pagination is set when the index is split into several pages.
+		Pagination *IndexPagination
+	}
+
+	// IndexPagination links the pages of a paginated index. Prev and Next
+	// are empty on the first and last page.
+	IndexPagination struct {
+		Page  int
+		Pages int
+		Prev  string
+		Next  string
+	}
+
+	// IndexGroup is a named group of index handlers. The name is empty when
+	// the index isn't grouped.
+	IndexGroup struct {
+		Name     string
+		Handlers []IndexHandler
+	}
+
+	IndexHandler struct {
+		Import string
+		URL    string
+		Repo   string
+		Hits   uint64
+	}
+
+	// Config is the configuration of a Handler, as parsed by ParseConfig.
+	Config struct {
+		Host          string              `yaml:"host,omitempty"`
+		RequireHost   bool                `yaml:"require_host,omitempty"`
+		ImportHost    string              `yaml:"import_host,omitempty"`
+		CacheAge      *int64              `yaml:"cache_max_age,omitempty"`
+		DefaultBranch string              `yaml:"default_branch,omitempty"`
+		Providers     map[string]Provider `yaml:"providers,omitempty"`
+		ShutdownDelay int64               `yaml:"shutdown_delay,omitempty"`
+		DrainTimeout  int64               `yaml:"drain_timeout,omitempty"`
+		MaxRequests   int64               `yaml:"max_requests,omitempty"`
+		ReadTimeout   int64               `yaml:"read_timeout,omitempty"`
+		ConnMaxAge    int64               `yaml:"conn_max_age,omitempty"`
+		MaxConnsPerIP int                 `yaml:"max_conns_per_ip,omitempty"`
+		DebugHeaders  bool                `yaml:"debug_headers,omitempty"`
+		HSTSPreload   bool                `yaml:"hsts_preload,omitempty"`
+		TLSCertFile   string              `yaml:"tls_cert_file,omitempty"`
+		TLSKeyFile    string              `yaml:"tls_key_file,omitempty"`
+		TLS           TLS                 `yaml:"tls,omitempty"`
+		HTTP3         bool                `yaml:"http3,omitempty"`
+		TraceContext  bool                `yaml:"trace_context,omitempty"`
+		SnapshotFile  string              `yaml:"snapshot_file,omitempty"`
+		RobotsTxt     string              `yaml:"robots_txt,omitempty"`
+		ShowHits      bool                `yaml:"show_hits,omitempty"`
+		SuggestCase   bool                `yaml:"suggest_case,omitempty"`
+		Attribution   bool                `yaml:"attribution,omitempty"`
+		DocsRedirect  bool                `yaml:"docs_redirect,omitempty"`
+		GodocHost     string              `yaml:"godoc_host,omitempty"`
+		IndexGroupBy  string              `yaml:"index_group_by,omitempty"`
+		IndexPageSize int                 `yaml:"index_page_size,omitempty"`
+		KeepAlive     KeepAlive           `yaml:"keepalive,omitempty"`
+		IndexPath     string              `yaml:"index_path,omitempty"`
+		IndexRedirect string              `yaml:"index_redirect,omitempty"`
+		RootBehavior  string              `yaml:"root_behavior,omitempty"`
+		UnknownQuery  string              `yaml:"unknown_query,omitempty"`
+		BodyTemplate  string              `yaml:"body_template,omitempty"`
+		ErrorTemplate string              `yaml:"error_template,omitempty"`
+		Separator     string              `yaml:"subpath_separator,omitempty"`
+		GoGetOnly     *bool               `yaml:"go_get_only,omitempty"`
+		BrowseTarget  string              `yaml:"browse_target,omitempty"`
+		CollapseSlash bool                `yaml:"collapse_slashes,omitempty"`
+
+		// IndexTemplateFile and VanityTemplateFile are files replacing the
+		// embedded HTML index and vanity page templates. They are given the
+		// same IndexTemplate and VanityTemplate data.
+		IndexTemplateFile  string `yaml:"index_template,omitempty"`
+		VanityTemplateFile string `yaml:"vanity_template,omitempty"`
+
+		// RootModule declares the whole domain as a single module, so that any
+		// path not otherwise configured resolves as a package within it. It is
+		// equivalent to configuring the "/" path.
+		RootModule *Path `yaml:"root_module,omitempty"`
+
+		// ProviderPrefixMode maps the first path segment to a provider host,
+		// e.g. "gh" to "github.com", so that "/gh/acme/x" resolves to
+		// https://github.com/acme/x without being configured in Paths.
+		ProviderPrefixMode map[string]string `yaml:"provider_prefix_mode,omitempty"`
+
+		// NegativeMaxAge sets the cache max age of 404 responses, in seconds,
+		// for the paths under each prefix, e.g. "/experimental", so that
+		// modules appearing there are picked up quickly.
+		NegativeMaxAge map[string]int64 `yaml:"negative_max_age,omitempty"`
+
+		// DisplayTemplate is a text template rendering the whole display of
+		// every path from a DisplayTemplate, taking precedence over the dir
+		// and file templates.
+		DisplayTemplate string `yaml:"display_template,omitempty"`
+
+		// TrustedProxies are the CIDRs or IPs of the proxies allowed to set
+		// forwarded headers, e.g. X-Forwarded-Proto. When empty, they are
+		// honored from any client.
+		TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
+
+		Paths Paths `yaml:"paths,omitempty"`
+	}
+
+	// Provider holds the settings shared by every path hosted on a
+	// given provider, e.g. "github" or "bitbucket".
+	Provider struct {
+		Branch       string `yaml:"branch,omitempty"`
+		DirTemplate  string `yaml:"dir_template,omitempty"`
+		FileTemplate string `yaml:"file_template,omitempty"`
+
+		// Hosts are the hosts of self-hosted instances of the provider,
+		// e.g. "gitlab.example.com", whose repos are inferred alike.
+		Hosts []string `yaml:"hosts,omitempty"`
+	}
+
+	// TLS restricts the parameters negotiated by HTTPS clients.
+	TLS struct {
+		CipherSuites []string `yaml:"cipher_suites,omitempty"`
+		Curves       []string `yaml:"curves,omitempty"`
+	}
+
+	// KeepAlive configures TCP keep-alive on accepted connections. The
+	// Go defaults apply when unset.
+	KeepAlive struct {
+		Enabled *bool `yaml:"enabled,omitempty"`
+		Period  int64 `yaml:"period,omitempty"` // in seconds
+	}
+
+	// Paths are the configured paths. In YAML, they are either a map
+	// keyed by path, or a list where each entry sets its path and takes
+	// priority over the entries after it. In the map form, paths differing
+	// only by a trailing slash are rejected as duplicates.
+	Paths []Path
+
+	Path struct {
+		Path       string `yaml:"path,omitempty"` // only set in the list form
+		Repo       string `yaml:"repo,omitempty"`
+		SourceRepo string `yaml:"source_repo,omitempty"`
+		Display    string `yaml:"display,omitempty"`
+		VCS        string `yaml:"vcs,omitempty"`
+		Branch     string `yaml:"branch,omitempty"`
+		CacheAge   *int64 `yaml:"cache_max_age,omitempty"`
+
+		// DirTemplate and FileTemplate override the provider's templates
+		// used to infer the display.
+		DirTemplate  string `yaml:"dir_template,omitempty"`
+		FileTemplate string `yaml:"file_template,omitempty"`
+
+		// DisplayTemplate overrides the global DisplayTemplate.
+		DisplayTemplate string `yaml:"display_template,omitempty"`
+
+		priority int
+		listed   bool // given in the list form, where duplicates are ordered
+	}
+
+	// providerRule describes how to infer the VCS and display of repos hosted
+	// on a known provider. The dir and file templates are the last two fields
+	// of the go-source meta tag, where {repo} and {branch} are replaced by the
+	// repo URL and branch.
+	providerRule struct {
+		name   string
+		prefix string
+		vcs    string // empty when the provider hosts several VCS
+		branch string
+		dir    string
+		file   string
+	}
+)
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.requests.Add(1)
+
+	defer h.latency.observe(time.Now())
+
+	// Import paths can't be built without a host, e.g. for HTTP/1.0
+	// requests without a Host header.
+	if h.Host(r) == "" {
+		http.Error(w, ErrHTTPHostMissing.Error(), http.StatusBadRequest)
+		return
+	}
+
+	path := r.URL.Path
+
+	// Import paths never contain empty elements, so "//foo//bar" can only
+	// mean "/foo/bar". Browsers are sent to the clean URL, while the go
+	// command is served right away.
+	if h.collapseSlash && strings.Contains(path, "//") {
+		path = collapseSlashes(path)
+
+		if !isGoGet(r) {
+			u := *r.URL
+			u.Path, u.RawPath = path, ""
+			http.Redirect(w, r, localURI(&u), http.StatusMovedPermanently)
+
+			return
+		}
+	}
+
+	current, version := splitVersion(path)
+
+	w.Header().Set("Cache-Control", h.cachectrl)
+
+	// Only go-get is meaningful. Other parameters are mostly added by scanners
+	// and cache busters, and fragment downstream caches.
+	if !h.knownQuery(r) {
+		switch h.unknownQuery {
+		case "redirect":
+			u := *r.URL
+			u.RawQuery = h.canonicalQuery(r)
+			http.Redirect(w, r, localURI(&u), http.StatusMovedPermanently)
+
+			return
+		case "reject":
+			http.Error(w, "unexpected query parameters", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if h.indexPath != "" && current == h.indexPath {
+		h.index(w, r)
+		return
+	}
+
+	pc, subpath := h.paths.findSep(current, h.separator)
+
+	// A wildcard path is preferred to a shorter configured prefix, e.g. "/"
+	// for /x/foo given "/x/*", but never to the same path configured as is.
+	if wc, wsub := h.findWildcard(current); wc != nil && (pc == nil || len(wc.Path) > len(pc.Path)) {
+		pc, subpath = wc, wsub
+	}
+
+	// So is a provider prefix, e.g. to "/" or the root module for
+	// /gh/acme/x, which would otherwise shadow every provider prefix.
+	if pp, psub := h.findProvider(current); pp != nil && (pc == nil || len(pp.Path) > len(pc.Path)) {
+		pc, subpath = pp, psub
+	}
+
+	if pc == nil && current == "/" {
+		h.index(w, r)
+		return
+	}
+
+	// When "/" is configured, root_behavior decides what browsers get there.
+	// The go command always gets the vanity page.
+	if pc != nil && pc.Path == "" && current == "/" && !isGoGet(r) {
+		switch h.rootBehavior {
+		case "index":
+			h.index(w, r)
+			return
+		case "redirect":
+			http.Redirect(w, r, pc.Repo, http.StatusFound)
+			return
+		}
+	}
+
+	if pc == nil {
+		h.misses.Add(1)
+
+		if cachectrl, ok := h.notFoundCacheControl(current); ok {
+			w.Header().Set("Cache-Control", cachectrl)
+		}
+
+		h.notFound(w, r)
+
+		return
+	}
+
+	if pc.CacheControl != "" {
+		w.Header().Set("Cache-Control", pc.CacheControl)
+	}
+
+	if hits, ok := h.hits[pc.Path]; ok {
+		hits.Add(1)
+	}
+
+	h.vanity(pc, subpath, version)(w, r)
+}
+
+// splitVersion splits a trailing module version query, e.g. "/mypkg@v1.2.3",
+// off path so that it isn't treated as part of the subpath.
+func splitVersion(path string) (string, string) {
+	i := strings.LastIndex(path, "@")
+	if i < 0 || i == len(path)-1 || strings.Contains(path[i+1:], "/") {
+		return path, ""
+	}
+
+	return path[:i], path[i+1:]
+}
+
+// collapseSlashes replaces consecutive slashes in path with a single one.
+func collapseSlashes(path string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' && i > 0 && path[i-1] == '/' {
+			continue
+		}
+
+		b.WriteByte(path[i])
+	}
+
+	return b.String()
+}
+
+// localURI returns the request URI of u as a redirect target on the same
+// host. Leading slashes are collapsed, as "//host/path" would redirect to
+// another host when the handler is served without http.ServeMux cleaning
+// paths.
+func localURI(u *url.URL) string {
+	return "/" + strings.TrimLeft(u.RequestURI(), "/")
+}
+
+// isGoGet reports whether r was made by the go command.
+func isGoGet(r *http.Request) bool {
+	return r.URL.Query().Get("go-get") == "1"
+}
+
+// knownQuery reports whether the query of r only has meaningful parameters,
+// whatever their order or encoding: go-get, and the page parameters when the
+// index is paginated.
+func (h *Handler) knownQuery(r *http.Request) bool {
+	query, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return false
+	}
+
+	for key := range query {
+		switch key {
+		case "go-get":
+		case "page", "per_page":
+			if h.indexPageSize <= 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// canonicalQuery returns the query of r with every parameter but go-get
+// removed. The page parameters are kept too when the index is paginated.
+func (h *Handler) canonicalQuery(r *http.Request) string {
+	keep := []string{"go-get"}
+	if h.indexPageSize > 0 {
+		keep = append(keep, "page", "per_page")
+	}
+
+	query := r.URL.Query()
+
+	var params []string
+
+	for _, key := range keep {
+		if v, ok := query[key]; ok && len(v) > 0 {
+			params = append(params, key+"="+url.QueryEscape(v[0]))
+		}
+	}
+
+	return strings.Join(params, "&")
+}
+
+// isGoClient reports whether r was made by the go command or another Go
+// toolchain client, such as a module proxy, which may omit go-get.
+func isGoClient(r *http.Request) bool {
+	return isGoGet(r) || strings.HasPrefix(r.UserAgent(), "Go-http-client/")
+}
+
+// notFoundCacheControl returns the Cache-Control value of a 404 response for
+// path, from the longest NegativeMaxAge prefix it is under.
+func (h *Handler) notFoundCacheControl(path string) (string, bool) {
+	var longest string
+
+	found := false
+
+	for prefix := range h.notFoundCachectrl {
+		under := path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+		if under && (!found || len(prefix) > len(longest)) {
+			longest, found = prefix, true
+		}
+	}
+
+	return h.notFoundCachectrl[longest], found
+}
+
+// notFound replies with a 404, as JSON for clients that accept it. When
+// enabled, a path differing only by case is suggested.
+func (h *Handler) notFound(w http.ResponseWriter, r *http.Request) {
+	var suggestion string
+
+	if h.suggestCase {
+		if pc, subpath := h.paths.findFold(r.URL.Path); pc != nil {
+			suggestion = h.ImportHost(r) + pc.Path
+			if subpath != "" {
+				suggestion += "/" + subpath
+			}
+		}
+	}
+
+	if !accepts(r, "application/json") {
+		if suggestion == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		http.Error(w, "404 page not found, did you mean "+suggestion+"?", http.StatusNotFound)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusNotFound)
+
+	_ = json.NewEncoder(w).Encode(struct {
+		Error      string `json:"error"`
+		Path       string `json:"path"`
+		Suggestion string `json:"suggestion,omitempty"`
+	}{
+		Error:      "not found",
+		Path:       r.URL.Path,
+		Suggestion: suggestion,
+	})
+}
+
+// index renders the index page.
+func (h *Handler) index(w http.ResponseWriter, r *http.Request) {
+	if h.indexRedirect != "" {
+		http.Redirect(w, r, h.indexRedirect, http.StatusFound)
+		return
+	}
+
+	paths, pagination, err := h.paginate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if pagination != nil && pagination.Page > pagination.Pages {
+		h.notFound(w, r)
+		return
+	}
+
+	host := h.ImportHost(r)
+	handlers := make([]IndexHandler, len(paths))
+
+	for i, pc := range paths {
+		handlers[i] = IndexHandler{
+			Import: host + pc.Path,
+			URL:    "https://" + h.Host(r) + pc.Path,
+			Repo:   pc.Repo,
+			Hits:   h.hits[pc.Path].Load(),
+		}
+	}
+
+	// Browsers get HTML, while tools can ask for Markdown or plain text.
+	name, contentType := "index.html.tmpl", "text/html; charset=utf-8"
+
+	switch {
+	case accepts(r, "text/html"):
+	case accepts(r, "text/markdown"):
+		name, contentType = "index.md.tmpl", "text/markdown; charset=utf-8"
+	case accepts(r, "text/plain"):
+		name, contentType = "index.txt.tmpl", "text/plain; charset=utf-8"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+
+	if pagination != nil && pagination.Prev != "" {
+		w.Header().Add("Link", "<"+pagination.Prev+`>; rel="prev"`)
+	}
+
+	if pagination != nil && pagination.Next != "" {
+		w.Header().Add("Link", "<"+pagination.Next+`>; rel="next"`)
+	}
+
+	// The page is buffered so that a failure can still be answered with the
+	// error page.
+	var page bytes.Buffer
+
+	if err := h.indexPages[name].Execute(&page, IndexTemplate{
+		Host:        host,
+		Handlers:    handlers,
+		Groups:      groupIndex(handlers, h.indexGroupBy),
+		ShowHits:    h.showHits,
+		Attribution: h.attribution,
+		Pagination:  pagination,
+	}); err != nil {
+		h.serverError(w, r)
+		return
+	}
+
+	_, _ = page.WriteTo(w)
+}
+
+// paginate returns the paths listed on the index page requested by r, from
+// its page and per_page query parameters. The pagination is nil when the
+// index isn't paginated or fits in a single page, and its page is past the
+// last one when the requested page doesn't exist.
+func (h *Handler) paginate(r *http.Request) (PathConfigSet, *IndexPagination, error) {
+	if h.indexPageSize == 0 {
+		return h.paths, nil, nil
+	}
+
+	query := r.URL.Query()
+	page, perPage := 1, h.indexPageSize
+
+	if v := query.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, nil, ErrInvalidPage
+		}
+
+		page = n
+	}
+
+	if v := query.Get("per_page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, nil, ErrInvalidPage
+		}
+
+		perPage = min(n, max(h.indexPageSize, indexMaxPageSize))
+	}
+
+	if page == 1 && len(h.paths) <= perPage {
+		return h.paths, nil, nil
+	}
+
+	pages := (len(h.paths) + perPage - 1) / perPage
+	pagination := &IndexPagination{Page: page, Pages: pages}
+
+	link := func(page int) string {
+		if query.Has("per_page") {
+			return fmt.Sprintf("?page=%d&per_page=%d", page, perPage)
+		}
+
+		return fmt.Sprintf("?page=%d", page)
+	}
+
+	if page > 1 && page <= pages {
+		pagination.Prev = link(page - 1)
+	}
+
+	if page < pages {
+		pagination.Next = link(page + 1)
+	}
+
+	start := min((page-1)*perPage, len(h.paths))
+
+	return h.paths[start:min(start+perPage, len(h.paths))], pagination, nil
+}
+
+// groupIndex groups the index handlers by the host (provider) or the host and
+// first path segment (org) of their repo. Groups are sorted by name, and keep
+// the order of handlers within them.
+func groupIndex(handlers []IndexHandler, by string) []IndexGroup {
+	if by == "" || by == "none" {
+		return []IndexGroup{{Handlers: handlers}}
+	}
+
+	var groups []IndexGroup
+
+	index := make(map[string]int)
+
+	for _, handler := range handlers {
+		name := handler.Repo
+
+		if u, err := url.Parse(handler.Repo); err == nil && u.Host != "" {
+			name = u.Host
+
+			if org, _, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/"); by == "org" && org != "" {
+				name += "/" + org
+			}
+		}
+
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, IndexGroup{Name: name})
+		}
+
+		groups[i].Handlers = append(groups[i].Handlers, handler)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+
+	return groups
+}
+
+// vanity renders the vanity url.
+func (h *Handler) vanity(pc *PathConfig, subpath, version string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		importPath := h.ImportHost(r) + pc.Path
+		if subpath := strings.Trim(subpath, "/"); subpath != "" {
+			importPath += "/" + subpath
+		}
+
+		setImportPath(r, importPath)
+
+		if h.debugHeaders {
+			w.Header().Set("X-Vanity-Path", pc.Path)
+			w.Header().Set("X-Vanity-Subpath", subpath)
+			w.Header().Set("X-Vanity-Repo", pc.Repo)
+		}
+
+		if h.docsRedirect && !isGoGet(r) {
+			http.Redirect(w, r, h.docsURL(r, pc, subpath, version), http.StatusFound)
+			return
+		}
+
+		if h.goGetOnly && !isGoClient(r) {
+			http.Redirect(w, r, h.browseURL(r, pc, subpath, version), http.StatusFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		data := VanityTemplate{
+			Import:  h.ImportHost(r) + pc.Path,
+			SubPath: subpath,
+			Repo:    pc.Repo,
+			Display: pc.Display,
+			VCS:     pc.VCS,
+			GoGet:   isGoGet(r),
+		}
+
+		var body bytes.Buffer
+		if err := h.body.Execute(&body, data); err != nil {
+			h.serverError(w, r)
+			return
+		}
+
+		// The body was escaped by its own template.
+		data.Body = template.HTML(body.String()) //nolint:gosec
+
+		var page bytes.Buffer
+
+		if err := h.vanityPage.Execute(&page, data); err != nil {
+			h.serverError(w, r)
+			return
+		}
+
+		_, _ = page.WriteTo(w)
+	}
+}
+
+// serverError replies with a 500 rendered from the error template, as JSON for
+// clients that accept it. Should the error template fail too, the bare
+// ErrUnableToRender message is sent instead.
+func (h *Handler) serverError(w http.ResponseWriter, r *http.Request) {
+	data := ErrorTemplate{
+		Status:     http.StatusInternalServerError,
+		StatusText: http.StatusText(http.StatusInternalServerError),
+		Error:      ErrUnableToRender.Error(),
+	}
+
+	if h.traceContext {
+		data.RequestID = TraceID(r)
+	}
+
+	// Failures are usually transient, so they must not be cached for as long
+	// as the pages themselves.
+	w.Header().Set("Cache-Control", "no-store")
+
+	if accepts(r, "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(data.Status)
+
+		_ = json.NewEncoder(w).Encode(struct {
+			Error     string `json:"error"`
+			RequestID string `json:"request_id,omitempty"`
+		}{
+			Error:     data.Error,
+			RequestID: data.RequestID,
+		})
+
+		return
+	}
+
+	var page bytes.Buffer
+	if err := h.errorPage.Execute(&page, data); err != nil {
+		http.Error(w, ErrUnableToRender.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(data.Status)
+
+	_, _ = page.WriteTo(w)
+}
+
+// docsURL returns the documentation URL of the package at subpath, at the
+// given version if any.
+func (h *Handler) docsURL(r *http.Request, pc *PathConfig, subpath, version string) string {
+	docs := "https://" + h.godocHost + "/" + h.ImportHost(r) + pc.Path
+
+	if subpath = strings.Trim(subpath, "/"); subpath != "" {
+		docs += "/" + subpath
+	}
+
+	if version != "" {
+		docs += "@" + version
+	}
+
+	return docs
+}
+
+// browseURL returns where browsers are redirected with go_get_only, depending
+// on browse_target. Only the "repo" target reveals the repo of pc.
+func (h *Handler) browseURL(r *http.Request, pc *PathConfig, subpath, version string) string {
+	switch h.browseTarget {
+	case "index":
+		return cmp.Or(h.indexPath, "/")
+	case "repo":
+		return pc.browseURL(subpath)
+	default:
+		return h.docsURL(r, pc, subpath, version)
+	}
+}
+
+// findProvider resolves path using the provider prefix convention, e.g. given
+// the prefix "gh" for "github.com", "/gh/acme/x/foo" resolves to the repo
+// https://github.com/acme/x with a subpath of "foo".
+func (h *Handler) findProvider(path string) (*PathConfig, string) {
+	// The owner and repository end up in the repo URL, so they are held to
+	// the same characters as the names matched by wildcards.
+	segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 4)
+	if len(segments) < 3 || !isWildcardName(segments[1]) || !isWildcardName(segments[2]) {
+		return nil, ""
+	}
+
+	host, ok := h.config.ProviderPrefixMode[segments[0]]
+	if !ok {
+		return nil, ""
+	}
+
+	root := "/" + strings.Join(segments[:3], "/")
+	repo := "https://" + strings.TrimSuffix(host, "/") + "/" + segments[1] + "/" + segments[2]
+
+	pc, err := h.config.pathConfig(root, Path{Repo: repo, VCS: "git"})
+	if err != nil {
+		return nil, ""
+	}
+
+	subpath := ""
+	if len(segments) == 4 {
+		subpath = segments[3]
+	}
+
+	return &pc, subpath
+}
+
+func (h *Handler) Host(r *http.Request) string {
+	host := h.host
+	if host == "" {
+		host = r.Host
+	}
+
+	return host
+}
+
+// PathConfigs returns the configured paths, sorted.
+func (h *Handler) PathConfigs() PathConfigSet {
+	return h.paths
+}
+
+// ImportHost returns the host of the import paths served for r, which may
+// differ from the host serving them, e.g. with split-horizon DNS. Import paths
+// can't contain a port, so that of the Host header is dropped; a configured
+// host is used as is.
+func (h *Handler) ImportHost(r *http.Request) string {
+	switch {
+	case h.importHost != "":
+		return h.importHost
+	case h.host != "":
+		return h.host
+	}
+
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		return r.Host
+	}
+
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+
+	return host
+}
+
+// accepts reports whether the Accept header of r explicitly lists mediaType,
+// other than with a zero quality, which refuses it.
+func accepts(r *http.Request, mediaType string) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, params, err := mime.ParseMediaType(accept); err == nil && mt == mediaType {
+			q, ok := params["q"]
+
+			return !ok || strings.Trim(q, "0.") != ""
+		}
+	}
+
+	return false
+}
+
+func (pset PathConfigSet) Len() int {
+	return len(pset)
+}
+
+// Less orders by path. Paths configured more than once, e.g. "/foo" and
+// "/foo/", are further ordered by priority, then by their other fields so that
+// the order never depends on the map iteration order of the config.
+func (pset PathConfigSet) Less(i, j int) bool {
+	return pset[i].less(pset[j])
+}
+
+// browseURL returns the URL browsing subpath in the repo, built from the
+// directory template of the go-source display, or the repo itself when the
+// subpath is empty or the template unknown.
+func (pc *PathConfig) browseURL(subpath string) string {
+	subpath = strings.Trim(subpath, "/")
+	fields := strings.Fields(pc.Display)
+
+	if subpath == "" || len(fields) != 3 || !strings.Contains(fields[1], "{/dir}") {
+		return pc.Repo
+	}
+
+	return strings.Replace(fields[1], "{/dir}", "/"+subpath, 1)
+}
+
+// less reports whether a sorts before b in a PathConfigSet.
+func (a PathConfig) less(b PathConfig) bool {
+	switch {
+	case a.Path != b.Path:
+		return a.Path < b.Path
+	case a.Priority != b.Priority:
+		return a.Priority < b.Priority
+	case a.Repo != b.Repo:
+		return a.Repo < b.Repo
+	case a.VCS != b.VCS:
+		return a.VCS < b.VCS
+	default:
+		return a.Display < b.Display
+	}
+}
+
+func (pset PathConfigSet) Swap(i, j int) {
+	pset[i], pset[j] = pset[j], pset[i]
+}
+
+func (pset PathConfigSet) find(path string) (pc *PathConfig, subpath string) {
+	return pset.findSep(path, "/")
+}
+
+// findSep is find with sep, e.g. "~" for "example.com/repo~submodule", also
+// separating a path from its subpath.
+func (pset PathConfigSet) findSep(path, sep string) (pc *PathConfig, subpath string) {
+	// Fast path with binary search to retrieve exact matches
+	// e.g. given pset ["/", "/abc", "/xyz"], path "/def" won't match.
+	i := sort.Search(len(pset), func(i int) bool {
+		return pset[i].Path >= path
+	})
+
+	if i < len(pset) && pset[i].Path == path {
+		return &pset[i], ""
+	}
+
+	if i > 0 && strings.HasPrefix(path, pset[i-1].Path+"/") {
+		j := pset.first(i - 1)
+		return &pset[j], path[len(pset[j].Path)+1:]
+	}
+
+	if i > 0 && sep != "/" && strings.HasPrefix(path, pset[i-1].Path+sep) {
+		j := pset.first(i - 1)
+		return &pset[j], path[len(pset[j].Path)+len(sep):]
+	}
+
+	// Slow path, now looking for the longest prefix/shortest subpath i.e.
+	// e.g. given pset ["/", "/abc/", "/abc/def/", "/xyz"/]
+	//  * query "/abc/foo" returns "/abc/" with a subpath of "foo"
+	//  * query "/x" returns "/" with a subpath of "x"
+	//
+	// Every prefix of path sorts before path, and a longer prefix sorts after
+	// a shorter one. After binary search with the >= lexicographic comparison,
+	// nothing at or after i is a prefix of path, so walking backwards from i
+	// the first prefix found is the longest one.
+	for j := i - 1; j >= 0; {
+		p := pset[j].Path
+
+		// We previously didn't find the path by search, so any route
+		// with equal or greater length is NOT a match.
+		if len(p) < len(path) && strings.HasPrefix(path, p) {
+			subpath = path[len(p):]
+			if sep != "/" {
+				subpath = strings.TrimPrefix(subpath, sep)
+			}
+
+			return &pset[pset.first(j)], subpath
+		}
+
+		// Any prefix of path sorting before p is also a prefix of their
+		// common prefix, so skip straight to the last path not greater than
+		// it. This bounds the work however long the path is.
+		c := 0
+		for c < len(p) && c < len(path) && p[c] == path[c] {
+			c++
+		}
+
+		j = sort.Search(j, func(k int) bool {
+			return pset[k].Path > path[:c]
+		}) - 1
+	}
+
+	return nil, ""
+}
+
+// first returns the index of the first of the paths equal to pset[i], which
+// is the one to prefer when a path is configured more than once.
+func (pset PathConfigSet) first(i int) int {
+	for i > 0 && pset[i-1].Path == pset[i].Path {
+		i--
+	}
+
+	return i
+}
+
+// findFold looks for the longest configured path matching path case
+// insensitively. It is only used to suggest the correct casing once find has
+// failed, so a linear scan is acceptable.
+func (pset PathConfigSet) findFold(path string) (pc *PathConfig, subpath string) {
+	for i := range pset {
+		p := pset[i].Path
+
+		if len(p) > len(path) || !strings.EqualFold(p, path[:len(p)]) {
+			continue
+		}
+
+		if len(p) < len(path) && path[len(p)] != '/' {
+			continue
+		}
+
+		if pc == nil || len(p) > len(pc.Path) {
+			pc = &pset[i]
+			subpath = strings.TrimPrefix(path[len(p):], "/")
+		}
+	}
+
+	return pc, subpath
+}
+
+// branch resolves the branch used to infer the display of a path hosted on the
+// given provider. The precedence is per-path > per-provider > global > fallback.
+func (c *Config) branch(provider string, p Path, fallback string) string {
+	if p.Branch != "" {
+		return p.Branch
+	}
+
+	if pv, ok := c.Providers[provider]; ok && pv.Branch != "" {
+		return pv.Branch
+	}
+
+	if c.DefaultBranch != "" {
+		return c.DefaultBranch
+	}
+
+	return fallback
+}
+
+// pathConfig builds the PathConfig for the given path, inferring the display
+// and VCS from the hosting provider when they are not set.
+func (c *Config) pathConfig(path string, e Path) (PathConfig, error) {
+	pc := PathConfig{
+		Path:     strings.TrimSuffix(path, "/"),
+		Repo:     e.Repo,
+		Display:  e.Display,
+		VCS:      e.VCS,
+		Priority: e.priority,
+	}
+
+	// The go-source links are built from the browsable source repo, which
+	// defaults to the repo that is cloned.
+	source := e.Repo
+
+	if e.SourceRepo != "" {
+		if u, err := url.Parse(e.SourceRepo); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return pc, NewInvalidSourceRepoError(path, e.SourceRepo)
+		}
+
+		source = e.SourceRepo
+	}
+
+	if e.CacheAge != nil {
+		if *e.CacheAge < 0 {
+			return pc, NewInvalidCacheMaxAgeError(path, *e.CacheAge)
+		}
+
+		pc.CacheControl = fmt.Sprintf("public, max-age=%d", *e.CacheAge)
+	}
+
+	if e.Display == "" {
+		var err error
+		if pc.Display, err = c.display(pc.Path, source, e); err != nil {
+			return pc, NewInvalidDisplayTemplateError(path, err)
+		}
+	}
+
+	switch rule := c.providerRule(e.Repo); {
+	case e.VCS != "":
+		// Already filled in.
+		if e.VCS != "bzr" && e.VCS != "git" && e.VCS != "hg" && e.VCS != "svn" {
+			return pc, NewInvalidVCSError(path, e.Repo)
+		}
+	case rule != nil && rule.vcs != "":
+		pc.VCS = rule.vcs
+	default:
+		return pc, NewInvalidVCSError(path, e.Repo)
+	}
+
+	return pc, nil
+}
+
+// display infers the go-source display of the source repo at path from the
+// display template, if any, or from the dir and file templates of its provider,
+// which may be overridden per provider and per path. It is empty when either
+// template is unknown.
+func (c *Config) display(path, source string, e Path) (string, error) {
+	var name, branch, dir, file string
+
+	if rule := c.providerRule(source); rule != nil {
+		name, branch, dir, file = rule.name, rule.branch, rule.dir, rule.file
+	}
+
+	if tmpl := cmp.Or(e.DisplayTemplate, c.DisplayTemplate); tmpl != "" {
+		host := cmp.Or(c.ImportHost, c.Host)
+
+		return executeText("display", tmpl, DisplayTemplate{
+			Repo:   source,
+			Branch: c.branch(name, e, cmp.Or(branch, "master")),
+			Import: host + path,
+			Host:   host,
+		})
+	}
+
+	if pv, ok := c.Providers[name]; ok && name != "" {
+		if pv.DirTemplate != "" {
+			dir = pv.DirTemplate
+		}
+
+		if pv.FileTemplate != "" {
+			file = pv.FileTemplate
+		}
+	}
+
+	if e.DirTemplate != "" {
+		dir = e.DirTemplate
+	}
+
+	if e.FileTemplate != "" {
+		file = e.FileTemplate
+	}
+
+	if dir == "" || file == "" {
+		return "", nil
+	}
+
+	// Unknown providers have no branch of their own to fall back to.
+	r := strings.NewReplacer("{repo}", source, "{branch}", c.branch(name, e, cmp.Or(branch, "master")))
+
+	return source + " " + r.Replace(dir) + " " + r.Replace(file), nil
+}
+
+// providerRule returns the rule of the provider hosting repo, if known from its
+// prefix or from the hosts configured for the provider.
+func (c *Config) providerRule(repo string) *providerRule {
+	if rule := findProviderRule(repo); rule != nil {
+		return rule
+	}
+
+	u, err := url.Parse(repo)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	for i := range providerRules {
+		if slices.Contains(c.Providers[providerRules[i].name].Hosts, u.Host) {
+			return &providerRules[i]
+		}
+	}
+
+	return nil
+}
+
+// findProviderRule returns the rule of the provider hosting repo, if known.
+func findProviderRule(repo string) *providerRule {
+	for i := range providerRules {
+		if strings.HasPrefix(repo, providerRules[i].prefix) {
+			return &providerRules[i]
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalYAML accepts both the map and the list forms of paths. Entries of
+// the map form are sorted by path and share the same priority.
+func (p *Paths) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []Path
+
+	if err := unmarshal(&list); err == nil {
+		for i := range list {
+			if list[i].Path == "" {
+				return ErrPathMissing
+			}
+
+			list[i].priority = i
+			list[i].listed = true
+		}
+
+		*p = list
+
+		return nil
+	}
+
+	var paths map[string]Path
+
+	if err := unmarshal(&paths); err != nil {
+		return err
+	}
+
+	*p = make(Paths, 0, len(paths))
+
+	for path, e := range paths {
+		e.Path = path
+		*p = append(*p, e)
+	}
+
+	sort.Slice(*p, func(i, j int) bool {
+		return (*p)[i].Path < (*p)[j].Path
+	})
+
+	return nil
+}
+
+// Duration returns the keep-alive period as expected by net.ListenConfig:
+// negative when disabled and zero for the Go default.
+func (k KeepAlive) Duration() time.Duration {
+	if k.Enabled != nil && !*k.Enabled {
+		return -1
+	}
+
+	return time.Duration(k.Period) * time.Second
+}
+
+// ParseConfig parses the raw YAML configuration.
+func ParseConfig(config []byte) (*Config, error) {
+	return ParseConfigFormat(config, "yaml")
+}
+
+// ParseConfigFormat parses the raw configuration in the given format,
+// either "yaml", "json" or "toml".
+func ParseConfigFormat(config []byte, format string) (*Config, error) {
+	var parsed Config
+
+	switch format {
+	case "yaml":
+	case "json":
+		// JSON is valid YAML, so only its stricter syntax is checked here.
+		if !json.Valid(config) {
+			return nil, ErrInvalidConfig
+		}
+	case "toml":
+		// TOML is converted to YAML, so that both share the same keys and
+		// forms of paths.
+		var doc map[string]any
+		if err := toml.Unmarshal(config, &doc); err != nil {
+			return nil, ErrInvalidConfig
+		}
+
+		var err error
+		if config, err = yaml.Marshal(doc); err != nil {
+			return nil, ErrInvalidConfig
+		}
+	default:
+		return nil, ErrInvalidConfigFormat
+	}
+
+	if err := yaml.Unmarshal(config, &parsed); err != nil {
+		return nil, ErrInvalidConfig
+	}
+
+	if err := parsed.validate(); err != nil {
+		return nil, err
+	}
+
+	return &parsed, nil
+}
+
+// validate checks the settings of c that aren't checked while building its
+// handler.
+func (c *Config) validate() error {
+	if c.RequireHost && c.Host == "" {
+		return ErrHTTPHostMissing
+	}
+
+	if c.ImportHost != "" {
+		if u, err := url.Parse("https://" + c.ImportHost); err != nil || u.Host != c.ImportHost {
+			return ErrInvalidImportHost
+		}
+	}
+
+	if c.GodocHost != "" {
+		if u, err := url.Parse("https://" + c.GodocHost); err != nil || u.Host != c.GodocHost {
+			return ErrInvalidGodocHost
+		}
+	}
+
+	if c.ShutdownDelay < 0 {
+		return ErrShutdownDelayNegative
+	}
+
+	if c.DrainTimeout < 0 {
+		return ErrDrainTimeoutNegative
+	}
+
+	if c.IndexPageSize < 0 {
+		return ErrIndexPageSizeNegative
+	}
+
+	if c.MaxRequests < 0 {
+		return ErrMaxRequestsNegative
+	}
+
+	if c.ReadTimeout < 0 || c.ConnMaxAge < 0 || c.MaxConnsPerIP < 0 {
+		return ErrConnLimitNegative
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return ErrTLSIncomplete
+	}
+
+	if _, err := c.TLS.Config(); err != nil {
+		return err
+	}
+
+	if _, err := ParseTrustedProxies(c.TrustedProxies); err != nil {
+		return err
+	}
+
+	if c.IndexPath != "" && !strings.HasPrefix(c.IndexPath, "/") {
+		return ErrInvalidIndexPath
+	}
+
+	if c.IndexRedirect != "" {
+		if u, err := url.Parse(c.IndexRedirect); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrInvalidIndexRedirect
+		}
+	}
+
+	if c.KeepAlive.Period < 0 {
+		return ErrKeepAlivePeriodNegative
+	}
+
+	if c.Separator != "" && c.Separator != "/" && strings.ContainsAny(c.Separator, "/@?#") {
+		return ErrInvalidSubpathSeparator
+	}
+
+	switch c.RootBehavior {
+	case "", "index", "vanity", "redirect":
+	default:
+		return ErrInvalidRootBehavior
+	}
+
+	switch c.UnknownQuery {
+	case "", "ignore", "redirect", "reject":
+	default:
+		return ErrInvalidUnknownQuery
+	}
+
+	switch c.BrowseTarget {
+	case "", "docs", "index", "repo":
+	default:
+		return ErrInvalidBrowseTarget
+	}
+
+	switch c.IndexGroupBy {
+	case "", "none", "provider", "org":
+	default:
+		return ErrInvalidIndexGroupBy
+	}
+
+	for _, e := range c.Paths {
+		if e.Path == "" {
+			return ErrPathMissing
+		}
+	}
+
+	return nil
+}
+
+// NewHandler returns the handler of the raw YAML configuration.
+func NewHandler(config []byte) (*Handler, error) {
+	parsed, err := ParseConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewHandlerFromConfig(parsed)
+}
+
+// NewHandlerFromConfig returns the handler of parsed, either parsed by
+// ParseConfig or built in Go, e.g. from a database of repos. It is validated
+// and its paths inferred the same way in both cases.
+func NewHandlerFromConfig(parsed *Config) (*Handler, error) {
+	if err := parsed.validate(); err != nil {
+		return nil, err
+	}
+
+	handler := &Handler{
+		host:          parsed.Host,
+		importHost:    parsed.ImportHost,
+		config:        parsed,
+		debugHeaders:  parsed.DebugHeaders,
+		showHits:      parsed.ShowHits,
+		suggestCase:   parsed.SuggestCase,
+		attribution:   parsed.Attribution,
+		docsRedirect:  parsed.DocsRedirect,
+		godocHost:     cmp.Or(parsed.GodocHost, "pkg.go.dev"),
+		indexGroupBy:  parsed.IndexGroupBy,
+		indexPageSize: parsed.IndexPageSize,
+		indexPath:     parsed.IndexPath,
+		indexRedirect: parsed.IndexRedirect,
+		rootBehavior:  parsed.RootBehavior,
+		unknownQuery:  parsed.UnknownQuery,
+		traceContext:  parsed.TraceContext,
+		separator:     "/",
+		goGetOnly:     parsed.GoGetOnly == nil || *parsed.GoGetOnly,
+		browseTarget:  parsed.BrowseTarget,
+		collapseSlash: parsed.CollapseSlash,
+		hits:          make(map[string]*atomic.Uint64, len(parsed.Paths)),
+		started:       time.Now(),
+		requests:      new(atomic.Uint64),
+		misses:        new(atomic.Uint64),
+		latency:       newHistogram(latencyBuckets),
+	}
+	cacheAge := int64(86400) // 24 hours (in seconds)
+
+	if parsed.CacheAge != nil {
+		cacheAge = *parsed.CacheAge
+		if cacheAge < 0 {
+			return nil, ErrCacheMaxAgeNegative
+		}
+	}
+
+	handler.cachectrl = fmt.Sprintf("public, max-age=%d", cacheAge)
+
+	if parsed.Separator != "" {
+		handler.separator = parsed.Separator
+	}
+
+	handler.notFoundCachectrl = make(map[string]string, len(parsed.NegativeMaxAge))
+
+	for prefix, age := range parsed.NegativeMaxAge {
+		if !strings.HasPrefix(prefix, "/") || age < 0 {
+			return nil, NewInvalidNegativeMaxAgeError(prefix, age)
+		}
+
+		handler.notFoundCachectrl[prefix] = fmt.Sprintf("public, max-age=%d", age)
+	}
+
+	for prefix, host := range parsed.ProviderPrefixMode {
+		if prefix == "" || strings.Contains(prefix, "/") || host == "" {
+			return nil, NewInvalidProviderPrefixError(prefix, host)
+		}
+	}
+
+	body := parsed.BodyTemplate
+	if body == "" {
+		body = defaultBodyTemplate
+	}
+
+	var err error
+
+	handler.body, err = template.New("body").Funcs(templateFuncs).Parse(body)
+	if err != nil {
+		return nil, NewInvalidBodyTemplateError(err)
+	}
+
+	// The embedded templates are parsed once here, so that a broken one
+	// fails at startup rather than on every request.
+	handler.indexPages = map[string]pageTemplate{
+		"index.html.tmpl": parseTemplate("index.html.tmpl"),
+		"index.md.tmpl":   parseTextTemplate("index.md.tmpl"),
+		"index.txt.tmpl":  parseTextTemplate("index.txt.tmpl"),
+	}
+	handler.vanityPage = parseTemplate("vanity.html.tmpl")
+	handler.errorPage = parseTemplate("error.html.tmpl")
+
+	if parsed.IndexTemplateFile != "" {
+		index, err := parseTemplateFile(parsed.IndexTemplateFile)
+		if err != nil {
+			return nil, NewInvalidTemplateFileError("index_template", err)
+		}
+
+		handler.indexPages["index.html.tmpl"] = index
+	}
+
+	if parsed.VanityTemplateFile != "" {
+		handler.vanityPage, err = parseVanityTemplateFile(parsed.VanityTemplateFile)
+		if err != nil {
+			return nil, NewInvalidTemplateFileError("vanity_template", err)
+		}
+	}
+
+	if parsed.ErrorTemplate != "" {
+		handler.errorPage, err = template.New("error").Funcs(templateFuncs).Parse(parsed.ErrorTemplate)
+		if err != nil {
+			return nil, NewInvalidErrorTemplateError(err)
+		}
+	}
+
+	entries, err := parsed.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	handler.paths, err = parsed.pathConfigs(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	handler.wildcards, err = parsed.wildcards()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pc := range handler.paths {
+		handler.hits[pc.Path] = new(atomic.Uint64)
+	}
+
+	return handler, nil
+}
+
+// parseVanityTemplateFile parses the vanity page template in the file at
+// path, checking that it renders the go-import meta tag, without which the go
+// command can't resolve any import path.
+func parseVanityTemplateFile(path string) (*template.Template, error) {
+	page, err := parseTemplateFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+
+	data := VanityTemplate{Import: "example.com/foo", Repo: "https://example.com/foo", VCS: "git", GoGet: true}
+	if err := page.Execute(&b, data); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Contains(b.Bytes(), []byte(`name="go-import"`)) {
+		return nil, ErrGoImportMissing
+	}
+
+	return page, nil
+}
+
+// entries returns the configured paths, including the root module but not the
+// wildcard paths.
+func (c *Config) entries() (Paths, error) {
+	entries := c.Paths
+
+	if c.RootModule != nil {
+		for _, e := range c.Paths {
+			if e.Path == "/" {
+				return nil, ErrRootModuleConflict
+			}
+		}
+
+		root := *c.RootModule
+		root.Path = "/"
+
+		entries = append(append(Paths{}, c.Paths...), root)
+	}
+
+	// Paths are matched without their trailing slash, so /foo and /foo/
+	// would silently shadow each other, unless ordered by the list form.
+	seen := make(map[string]string, len(entries))
+
+	for _, e := range entries {
+		if e.listed {
+			continue
+		}
+
+		path := strings.TrimSuffix(e.Path, "/")
+		if first, ok := seen[path]; ok {
+			return nil, NewDuplicatePathError(e.Path, first)
+		}
+
+		seen[path] = e.Path
+	}
+
+	// Wildcard paths are matched separately.
+	paths := make(Paths, 0, len(entries))
+
+	for _, e := range entries {
+		if !e.isWildcard() {
+			paths = append(paths, e)
+		}
+	}
+
+	return paths, nil
+}
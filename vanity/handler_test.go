@@ -0,0 +1,2848 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanity
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		path   string
+
+		goImport string
+		goSource string
+	}{
+		{
+			name: "explicit display",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    display: https://github.com/rakyll/portmidi _ _\n",
+			path:     "/portmidi",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi _ _",
+		},
+		{
+			name: "display GitHub inference",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n",
+			path:     "/portmidi",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi https://github.com/rakyll/portmidi/tree/master{/dir} https://github.com/rakyll/portmidi/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			name: "Bitbucket Mercurial",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /gopdf:\n" +
+				"    repo: https://bitbucket.org/zombiezen/gopdf\n" +
+				"    vcs: hg\n",
+			path:     "/gopdf",
+			goImport: "example.com/gopdf hg https://bitbucket.org/zombiezen/gopdf",
+			goSource: "example.com/gopdf https://bitbucket.org/zombiezen/gopdf https://bitbucket.org/zombiezen/gopdf/src/default{/dir} https://bitbucket.org/zombiezen/gopdf/src/default{/dir}/{file}#{file}-{line}",
+		},
+		{
+			name: "Bitbucket Git",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /mygit:\n" +
+				"    repo: https://bitbucket.org/zombiezen/mygit\n" +
+				"    vcs: git\n",
+			path:     "/mygit",
+			goImport: "example.com/mygit git https://bitbucket.org/zombiezen/mygit",
+			goSource: "example.com/mygit https://bitbucket.org/zombiezen/mygit https://bitbucket.org/zombiezen/mygit/src/default{/dir} https://bitbucket.org/zombiezen/mygit/src/default{/dir}/{file}#{file}-{line}",
+		},
+		{
+			name: "GitLab",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /gitlab:\n" +
+				"    repo: https://gitlab.com/gitlab-org/api/client-go\n",
+			path:     "/gitlab",
+			goImport: "example.com/gitlab git https://gitlab.com/gitlab-org/api/client-go",
+			goSource: "example.com/gitlab https://gitlab.com/gitlab-org/api/client-go https://gitlab.com/gitlab-org/api/client-go/-/tree/master{/dir} https://gitlab.com/gitlab-org/api/client-go/-/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			name: "self-hosted GitLab",
+			config: "host: example.com\n" +
+				"providers:\n" +
+				"  gitlab:\n" +
+				"    branch: main\n" +
+				"    hosts: [gitlab.example.com]\n" +
+				"paths:\n" +
+				"  /tools:\n" +
+				"    repo: https://gitlab.example.com/acme/tools\n",
+			path:     "/tools",
+			goImport: "example.com/tools git https://gitlab.example.com/acme/tools",
+			goSource: "example.com/tools https://gitlab.example.com/acme/tools https://gitlab.example.com/acme/tools/-/tree/main{/dir} https://gitlab.example.com/acme/tools/-/blob/main{/dir}/{file}#L{line}",
+		},
+		{
+			name: "Codeberg",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /forgejo:\n" +
+				"    repo: https://codeberg.org/forgejo/forgejo\n",
+			path:     "/forgejo",
+			goImport: "example.com/forgejo git https://codeberg.org/forgejo/forgejo",
+			goSource: "example.com/forgejo https://codeberg.org/forgejo/forgejo https://codeberg.org/forgejo/forgejo/src/branch/master{/dir} https://codeberg.org/forgejo/forgejo/src/branch/master{/dir}/{file}#L{line}",
+		},
+		{
+			name: "self-hosted Gitea",
+			config: "host: example.com\n" +
+				"providers:\n" +
+				"  codeberg:\n" +
+				"    branch: main\n" +
+				"    hosts: [gitea.example.com]\n" +
+				"paths:\n" +
+				"  /tea:\n" +
+				"    repo: https://gitea.example.com/acme/tea\n",
+			path:     "/tea",
+			goImport: "example.com/tea git https://gitea.example.com/acme/tea",
+			goSource: "example.com/tea https://gitea.example.com/acme/tea https://gitea.example.com/acme/tea/src/branch/main{/dir} https://gitea.example.com/acme/tea/src/branch/main{/dir}/{file}#L{line}",
+		},
+		{
+			name: "Codeberg explicit display",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /forgejo:\n" +
+				"    repo: https://codeberg.org/forgejo/forgejo\n" +
+				"    display: https://codeberg.org/forgejo/forgejo _ _\n",
+			path:     "/forgejo",
+			goImport: "example.com/forgejo git https://codeberg.org/forgejo/forgejo",
+			goSource: "example.com/forgejo https://codeberg.org/forgejo/forgejo _ _",
+		},
+		{
+			name: "global default branch",
+			config: "host: example.com\n" +
+				"default_branch: main\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n",
+			path:     "/portmidi",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi https://github.com/rakyll/portmidi/tree/main{/dir} https://github.com/rakyll/portmidi/blob/main{/dir}/{file}#L{line}",
+		},
+		{
+			name: "path branch overrides global",
+			config: "host: example.com\n" +
+				"default_branch: master\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    branch: main\n",
+			path:     "/portmidi",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi https://github.com/rakyll/portmidi/tree/main{/dir} https://github.com/rakyll/portmidi/blob/main{/dir}/{file}#L{line}",
+		},
+		{
+			name: "provider branch overrides global",
+			config: "host: example.com\n" +
+				"default_branch: main\n" +
+				"providers:\n" +
+				"  github:\n" +
+				"    branch: trunk\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n",
+			path:     "/portmidi",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi https://github.com/rakyll/portmidi/tree/trunk{/dir} https://github.com/rakyll/portmidi/blob/trunk{/dir}/{file}#L{line}",
+		},
+		{
+			name: "path branch overrides provider",
+			config: "host: example.com\n" +
+				"providers:\n" +
+				"  bitbucket:\n" +
+				"    branch: main\n" +
+				"paths:\n" +
+				"  /gopdf:\n" +
+				"    repo: https://bitbucket.org/zombiezen/gopdf\n" +
+				"    vcs: hg\n" +
+				"    branch: stable\n",
+			path:     "/gopdf",
+			goImport: "example.com/gopdf hg https://bitbucket.org/zombiezen/gopdf",
+			goSource: "example.com/gopdf https://bitbucket.org/zombiezen/gopdf https://bitbucket.org/zombiezen/gopdf/src/stable{/dir} https://bitbucket.org/zombiezen/gopdf/src/stable{/dir}/{file}#{file}-{line}",
+		},
+		{
+			name: "provider prefix mode",
+			config: "host: example.com\n" +
+				"provider_prefix_mode:\n" +
+				"  gh: github.com\n" +
+				"  gl: gitlab.com\n",
+			path:     "/gh/rakyll/portmidi/foo",
+			goImport: "example.com/gh/rakyll/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/gh/rakyll/portmidi https://github.com/rakyll/portmidi https://github.com/rakyll/portmidi/tree/master{/dir} https://github.com/rakyll/portmidi/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			name: "configured path wins over provider prefix mode",
+			config: "host: example.com\n" +
+				"provider_prefix_mode:\n" +
+				"  gh: github.com\n" +
+				"paths:\n" +
+				"  /gh/rakyll/portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    display: https://github.com/rakyll/portmidi _ _\n",
+			path:     "/gh/rakyll/portmidi",
+			goImport: "example.com/gh/rakyll/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/gh/rakyll/portmidi https://github.com/rakyll/portmidi _ _",
+		},
+		{
+			name: "provider prefix mode wins over the root module",
+			config: "host: example.com\n" +
+				"provider_prefix_mode:\n" +
+				"  gh: github.com\n" +
+				"root_module:\n" +
+				"  repo: https://github.com/example/root\n",
+			path:     "/gh/rakyll/portmidi",
+			goImport: "example.com/gh/rakyll/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/gh/rakyll/portmidi https://github.com/rakyll/portmidi https://github.com/rakyll/portmidi/tree/master{/dir} https://github.com/rakyll/portmidi/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			name: "root module below an invalid provider prefix",
+			config: "host: example.com\n" +
+				"provider_prefix_mode:\n" +
+				"  gh: github.com\n" +
+				"root_module:\n" +
+				"  repo: https://github.com/example/root\n",
+			path:     "/gh/rakyll",
+			goImport: "example.com git https://github.com/example/root",
+			goSource: "example.com https://github.com/example/root https://github.com/example/root/tree/master{/dir} https://github.com/example/root/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			name: "source repo on a different host",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://git.internal.example.com/rakyll/portmidi\n" +
+				"    source_repo: https://github.com/rakyll/portmidi\n" +
+				"    vcs: git\n",
+			path:     "/portmidi",
+			goImport: "example.com/portmidi git https://git.internal.example.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi https://github.com/rakyll/portmidi/tree/master{/dir} https://github.com/rakyll/portmidi/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			name: "source repo with explicit display",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    source_repo: https://bitbucket.org/rakyll/portmidi\n" +
+				"    display: https://github.com/rakyll/portmidi _ _\n",
+			path:     "/portmidi",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi _ _",
+		},
+		{
+			name: "version suffix",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    display: https://github.com/rakyll/portmidi _ _\n",
+			path:     "/portmidi@v1.2.3",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi _ _",
+		},
+		{
+			name: "provider file template",
+			config: "host: example.com\n" +
+				"providers:\n" +
+				"  github:\n" +
+				"    file_template: \"{repo}/blob/{branch}{/dir}/{file}?line={line}\"\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n",
+			path:     "/portmidi",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi https://github.com/rakyll/portmidi/tree/master{/dir} https://github.com/rakyll/portmidi/blob/master{/dir}/{file}?line={line}",
+		},
+		{
+			name: "path templates for an unknown provider",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /forge:\n" +
+				"    repo: https://forge.example.com/acme/forge\n" +
+				"    vcs: git\n" +
+				"    branch: trunk\n" +
+				"    dir_template: \"{repo}/browse/{branch}{/dir}\"\n" +
+				"    file_template: \"{repo}/browse/{branch}{/dir}/{file}?line={line}\"\n",
+			path:     "/forge",
+			goImport: "example.com/forge git https://forge.example.com/acme/forge",
+			goSource: "example.com/forge https://forge.example.com/acme/forge https://forge.example.com/acme/forge/browse/trunk{/dir} https://forge.example.com/acme/forge/browse/trunk{/dir}/{file}?line={line}",
+		},
+		{
+			name: "path templates for an unknown provider without branch",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /forge:\n" +
+				"    repo: https://forge.example.com/acme/forge\n" +
+				"    vcs: git\n" +
+				"    dir_template: \"{repo}/browse/{branch}{/dir}\"\n" +
+				"    file_template: \"{repo}/browse/{branch}{/dir}/{file}?line={line}\"\n",
+			path:     "/forge",
+			goImport: "example.com/forge git https://forge.example.com/acme/forge",
+			goSource: "example.com/forge https://forge.example.com/acme/forge https://forge.example.com/acme/forge/browse/master{/dir} https://forge.example.com/acme/forge/browse/master{/dir}/{file}?line={line}",
+		},
+		{
+			name: "display template",
+			config: "host: example.com\n" +
+				"default_branch: main\n" +
+				"display_template: '{{.Repo}} {{.Repo}}/browse/{{.Branch}}{/dir} {{.Repo}}/browse/{{.Branch}}{/dir}/{file}?at={{.Import | urlquery}}#{line}'\n" +
+				"paths:\n" +
+				"  /forge:\n" +
+				"    repo: https://forge.example.com/acme/forge\n" +
+				"    vcs: git\n",
+			path:     "/forge",
+			goImport: "example.com/forge git https://forge.example.com/acme/forge",
+			goSource: "example.com/forge https://forge.example.com/acme/forge https://forge.example.com/acme/forge/browse/main{/dir} https://forge.example.com/acme/forge/browse/main{/dir}/{file}?at=example.com%2Fforge#{line}",
+		},
+		{
+			name: "path display template overrides global",
+			config: "host: example.com\n" +
+				"display_template: '{{.Repo}} _ _'\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    display_template: '{{.Repo}} {{.Repo}}/tree/{{.Branch}}{/dir} {{.Repo}}/blob/{{.Branch}}{/dir}/{file}#L{line}'\n",
+			path:     "/portmidi",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi https://github.com/rakyll/portmidi/tree/master{/dir} https://github.com/rakyll/portmidi/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			name: "paths as a list",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  - path: /portmidi/\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    display: https://github.com/rakyll/portmidi _ _\n" +
+				"  - path: /portmidi\n" +
+				"    repo: https://github.com/rakyll/portmidi-fork\n",
+			path:     "/portmidi/foo",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi _ _",
+		},
+		{
+			name: "subpath",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /portmidi:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    display: https://github.com/rakyll/portmidi _ _\n",
+			path:     "/portmidi/foo",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi _ _",
+		},
+		{
+			name: "subpath with trailing config slash",
+			config: "host: example.com\n" +
+				"paths:\n" +
+				"  /portmidi/:\n" +
+				"    repo: https://github.com/rakyll/portmidi\n" +
+				"    display: https://github.com/rakyll/portmidi _ _\n",
+			path:     "/portmidi/foo",
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+			goSource: "example.com/portmidi https://github.com/rakyll/portmidi _ _",
+		},
+	}
+
+	for _, test := range tests {
+		h, err := NewHandler([]byte(test.config))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		s := httptest.NewServer(h)
+		resp, err := http.Get(s.URL + test.path)
+
+		if err != nil {
+			s.Close()
+			t.Errorf("%s: http.Get: %v", test.name, err)
+			continue
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		s.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: status code = %s; want 200 OK", test.name, resp.Status)
+		}
+
+		if err != nil {
+			t.Errorf("%s: io.ReadAll: %v", test.name, err)
+			continue
+		}
+
+		if got := findMeta(data, "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.name, got, test.goImport)
+		}
+
+		if got := findMeta(data, "go-source"); got != test.goSource {
+			t.Errorf("%s: meta go-source = %q; want %q", test.name, got, test.goSource)
+		}
+	}
+}
+
+func TestBadConfigs(t *testing.T) {
+	badConfigs := []string{
+		"paths:\n" +
+			"  /missingvcs:\n" +
+			"    repo: https://bitbucket.org/zombiezen/gopdf\n",
+		"paths:\n" +
+			"  /unknownvcs:\n" +
+			"    repo: https://bitbucket.org/zombiezen/gopdf\n" +
+			"    vcs: xyzzy\n",
+		"cache_max_age: -1\n" +
+			"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n",
+		"provider_prefix_mode:\n" +
+			"  gh/x: github.com\n",
+		"tls_cert_file: cert.pem\n",
+		"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n" +
+			"    source_repo: github.com/rakyll/portmidi\n",
+		"index_group_by: repo\n",
+		"keepalive:\n" +
+			"  period: -1\n",
+		"index_path: _index\n",
+		"root_module:\n" +
+			"  repo: https://github.com/rakyll/portmidi\n" +
+			"paths:\n" +
+			"  /:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n",
+		"index_redirect: acme.dev\n",
+		"paths:\n" +
+			"  - repo: https://github.com/rakyll/portmidi\n",
+		"root_behavior: refresh\n",
+		"unknown_query: drop\n",
+		"negative_max_age:\n  experimental: 60\n",
+		"negative_max_age:\n  /experimental: -1\n",
+		"max_requests: -1\n",
+		"body_template: '{{.Repo'\n",
+		"error_template: '{{.Status'\n",
+		"paths:\n" +
+			"  /gitlab:\n" +
+			"    repo: https://gitlab.example.com/group/project\n",
+		"subpath_separator: /~\n",
+		"read_timeout: -1\n",
+		"max_conns_per_ip: -1\n",
+		"require_host: true\n" +
+			"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n",
+		"import_host: https://go.example.com\n",
+		"import_host: go.example.com/foo\n",
+		"shutdown_delay: -1\n" +
+			"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n",
+		"tls:\n  cipher_suites: [TLS_RSA_WITH_RC4_128_SHA]\n",
+		"tls:\n  curves: [P-224]\n",
+		"drain_timeout: -1\n",
+		"index_page_size: -1\n",
+		"trusted_proxies: [10.0.0.0/33]\n",
+		"display_template: '{{.Repo'\n" +
+			"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n",
+		"paths:\n" +
+			"  /portmidi:\n" +
+			"    repo: https://github.com/rakyll/portmidi\n" +
+			"    display_template: '{{.Owner}}'\n",
+	}
+	for _, config := range badConfigs {
+		_, err := NewHandler([]byte(config))
+		if err == nil {
+			t.Errorf("expected config to produce an error, but did not:\n%s", config)
+		}
+	}
+}
+
+func TestMergeKeys(t *testing.T) {
+	config := "defaults: &defaults\n" +
+		"  vcs: git\n" +
+		"  branch: main\n" +
+		"paths:\n" +
+		"  /portmidi:\n" +
+		"    <<: *defaults\n" +
+		"    repo: https://github.com/rakyll/portmidi\n" +
+		"  /mygit:\n" +
+		"    <<: *defaults\n" +
+		"    repo: https://bitbucket.org/zombiezen/mygit\n" +
+		"    branch: develop\n"
+
+	h, err := NewHandler([]byte(config))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	want := PathConfigSet{
+		{
+			Path:    "/mygit",
+			Repo:    "https://bitbucket.org/zombiezen/mygit",
+			Display: "https://bitbucket.org/zombiezen/mygit https://bitbucket.org/zombiezen/mygit/src/develop{/dir} https://bitbucket.org/zombiezen/mygit/src/develop{/dir}/{file}#{file}-{line}",
+			VCS:     "git",
+		},
+		{
+			Path:    "/portmidi",
+			Repo:    "https://github.com/rakyll/portmidi",
+			Display: "https://github.com/rakyll/portmidi https://github.com/rakyll/portmidi/tree/main{/dir} https://github.com/rakyll/portmidi/blob/main{/dir}/{file}#L{line}",
+			VCS:     "git",
+		},
+	}
+
+	if !reflect.DeepEqual(h.paths, want) {
+		t.Errorf("paths = %+v; want %+v", h.paths, want)
+	}
+}
+
+func TestSourceHut(t *testing.T) {
+	config := "paths:\n" +
+		"  /scdoc:\n" +
+		"    repo: https://git.sr.ht/~sircmpwn/scdoc\n" +
+		"  /hgsrht:\n" +
+		"    repo: https://hg.sr.ht/~sircmpwn/hg.sr.ht\n"
+
+	h, err := NewHandler([]byte(config))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	want := PathConfigSet{
+		{
+			Path:    "/hgsrht",
+			Repo:    "https://hg.sr.ht/~sircmpwn/hg.sr.ht",
+			Display: "https://hg.sr.ht/~sircmpwn/hg.sr.ht https://hg.sr.ht/~sircmpwn/hg.sr.ht/browse{/dir}?rev=tip https://hg.sr.ht/~sircmpwn/hg.sr.ht/browse{/dir}/{file}?rev=tip#L{line}",
+			VCS:     "hg",
+		},
+		{
+			Path:    "/scdoc",
+			Repo:    "https://git.sr.ht/~sircmpwn/scdoc",
+			Display: "https://git.sr.ht/~sircmpwn/scdoc https://git.sr.ht/~sircmpwn/scdoc/tree/master/item{/dir} https://git.sr.ht/~sircmpwn/scdoc/tree/master/item{/dir}/{file}#L{line}",
+			VCS:     "git",
+		},
+	}
+
+	if !reflect.DeepEqual(h.paths, want) {
+		t.Errorf("paths = %+v; want %+v", h.paths, want)
+	}
+}
+
+func findMeta(data []byte, name string) string {
+	var sep []byte
+	sep = append(sep, `<meta name="`...)
+	sep = append(sep, name...)
+	sep = append(sep, `" content="`...)
+	i := bytes.Index(data, sep)
+	if i == -1 {
+		return ""
+	}
+	content := data[i+len(sep):]
+	j := bytes.IndexByte(content, '"')
+	if j == -1 {
+		return ""
+	}
+	return string(content[:j])
+}
+
+func TestPathConfigSetFind(t *testing.T) {
+	tests := []struct {
+		paths   []string
+		query   string
+		want    string
+		subpath string
+	}{
+		{
+			paths: []string{"/portmidi"},
+			query: "/portmidi",
+			want:  "/portmidi",
+		},
+		{
+			paths: []string{"/portmidi"},
+			query: "/portmidi/",
+			want:  "/portmidi",
+		},
+		{
+			paths: []string{"/portmidi"},
+			query: "/foo",
+			want:  "",
+		},
+		{
+			paths: []string{"/portmidi"},
+			query: "/zzz",
+			want:  "",
+		},
+		{
+			paths: []string{"/abc", "/portmidi", "/xyz"},
+			query: "/portmidi",
+			want:  "/portmidi",
+		},
+		{
+			paths:   []string{"/abc", "/portmidi", "/xyz"},
+			query:   "/portmidi/foo",
+			want:    "/portmidi",
+			subpath: "foo",
+		},
+		{
+			paths:   []string{"/example/helloworld", "/", "/y", "/foo"},
+			query:   "/x",
+			want:    "/",
+			subpath: "x",
+		},
+		{
+			paths:   []string{"/example/helloworld", "/", "/y", "/foo"},
+			query:   "/",
+			want:    "/",
+			subpath: "",
+		},
+		{
+			paths:   []string{"/example/helloworld", "/", "/y", "/foo"},
+			query:   "/example",
+			want:    "/",
+			subpath: "example",
+		},
+		{
+			paths:   []string{"/example/helloworld", "/", "/y", "/foo"},
+			query:   "/example/foo",
+			want:    "/",
+			subpath: "example/foo",
+		},
+		{
+			paths: []string{"/example/helloworld", "/", "/y", "/foo"},
+			query: "/y",
+			want:  "/y",
+		},
+		{
+			paths:   []string{"/example/helloworld", "/", "/y", "/foo"},
+			query:   "/x/y/",
+			want:    "/",
+			subpath: "x/y/",
+		},
+		{
+			paths: []string{"/example/helloworld", "/y", "/foo"},
+			query: "/x",
+			want:  "",
+		},
+		{
+			paths:   []string{"/", "/ab", "/abc/x", "/abd"},
+			query:   "/abzz",
+			want:    "/ab",
+			subpath: "zz",
+		},
+		{
+			paths:   []string{"/", "/ab", "/abc/x", "/abd"},
+			query:   "/abc/y",
+			want:    "/ab",
+			subpath: "c/y",
+		},
+		{
+			paths: []string{"/b", "/c"},
+			query: "/d",
+			want:  "",
+		},
+	}
+	emptyToNil := func(s string) string {
+		if s == "" {
+			return "<nil>"
+		}
+		return s
+	}
+	for _, test := range tests {
+		pset := make(PathConfigSet, len(test.paths))
+		for i := range test.paths {
+			pset[i].Path = test.paths[i]
+		}
+		sort.Sort(pset)
+		pc, subpath := pset.find(test.query)
+		var got string
+		if pc != nil {
+			got = pc.Path
+		}
+		if got != test.want || subpath != test.subpath {
+			t.Errorf("pathConfigSet(%v).find(%q) = %v, %v; want %v, %v",
+				test.paths, test.query, emptyToNil(got), subpath, emptyToNil(test.want), test.subpath)
+		}
+	}
+}
+
+func TestPathConfigSetFindSep(t *testing.T) {
+	tests := []struct {
+		paths   []string
+		query   string
+		want    string
+		subpath string
+	}{
+		{
+			paths:   []string{"/repo"},
+			query:   "/repo~submodule",
+			want:    "/repo",
+			subpath: "submodule",
+		},
+		{
+			paths:   []string{"/repo"},
+			query:   "/repo/pkg",
+			want:    "/repo",
+			subpath: "pkg",
+		},
+		{
+			paths:   []string{"/repo", "/repo~submodule"},
+			query:   "/repo~submodule/pkg",
+			want:    "/repo~submodule",
+			subpath: "pkg",
+		},
+		{
+			paths:   []string{"/repo", "/repo~sub", "/repo~tools"},
+			query:   "/repo~other",
+			want:    "/repo",
+			subpath: "other",
+		},
+		{
+			paths: []string{"/repo"},
+			query: "/other~submodule",
+			want:  "",
+		},
+	}
+	emptyToNil := func(s string) string {
+		if s == "" {
+			return "<nil>"
+		}
+		return s
+	}
+	for _, test := range tests {
+		pset := make(PathConfigSet, len(test.paths))
+		for i := range test.paths {
+			pset[i].Path = test.paths[i]
+		}
+		sort.Sort(pset)
+		pc, subpath := pset.findSep(test.query, "~")
+		var got string
+		if pc != nil {
+			got = pc.Path
+		}
+		if got != test.want || subpath != test.subpath {
+			t.Errorf("pathConfigSet(%v).findSep(%q, \"~\") = %v, %v; want %v, %v",
+				test.paths, test.query, emptyToNil(got), subpath, emptyToNil(test.want), test.subpath)
+		}
+	}
+}
+
+func TestProviderPrefixModeNotFound(t *testing.T) {
+	h, err := NewHandler([]byte("provider_prefix_mode:\n  gh: github.com\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	for _, path := range []string{
+		"/gh", "/gh/rakyll", "/gh/rakyll/", "/bb/rakyll/portmidi",
+		"/gh/../..?go-get=1", "/gh/./portmidi?go-get=1", "/gh/rakyll/..?go-get=1",
+		`/gh/b"x/portmidi?go-get=1`, "/gh/rakyll/port%20midi?go-get=1", "/gh/rakyll/port<midi>?go-get=1",
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d; want %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{
+			name:        "html",
+			accept:      "text/html",
+			contentType: "text/plain; charset=utf-8",
+			body:        "404 page not found\n",
+		},
+		{
+			name:        "json",
+			accept:      "text/html;q=0.9, application/json",
+			contentType: "application/json",
+			body:        `{"error":"not found","path":"/foo"}` + "\n",
+		},
+		{
+			name:        "json refused",
+			accept:      "text/html, application/json;q=0",
+			contentType: "text/plain; charset=utf-8",
+			body:        "404 page not found\n",
+		},
+	}
+
+	h, err := NewHandler([]byte("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/foo", nil)
+		r.Header.Set("Accept", test.accept)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, http.StatusNotFound)
+		}
+
+		if got := w.Header().Get("Content-Type"); got != test.contentType {
+			t.Errorf("%s: Content-Type = %q; want %q", test.name, got, test.contentType)
+		}
+
+		if got := w.Body.String(); got != test.body {
+			t.Errorf("%s: body = %q; want %q", test.name, got, test.body)
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	h, err := NewHandler([]byte("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	for _, path := range []string{"/", "/portmidi", "/portmidi?go-get=1"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if got, want := w.Header().Get("Content-Type"), "text/html; charset=utf-8"; got != want {
+			t.Errorf("%s: Content-Type = %q; want %q", path, got, want)
+		}
+	}
+}
+
+func TestIndexFormats(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{
+			name:        "markdown",
+			accept:      "text/markdown",
+			contentType: "text/markdown; charset=utf-8",
+			body: "# example.com\n\n" +
+				"- [example.com/foo](https://example.com/foo): https://github.com/example/foo\n" +
+				"- [example.com/portmidi](https://example.com/portmidi): https://github.com/rakyll/portmidi\n",
+		},
+		{
+			name:        "grouped markdown",
+			config:      "index_group_by: org\n",
+			accept:      "text/markdown",
+			contentType: "text/markdown; charset=utf-8",
+			body: "# example.com\n\n" +
+				"## github.com/example\n\n" +
+				"- [example.com/foo](https://example.com/foo): https://github.com/example/foo\n\n" +
+				"## github.com/rakyll\n\n" +
+				"- [example.com/portmidi](https://example.com/portmidi): https://github.com/rakyll/portmidi\n",
+		},
+		{
+			name:        "paginated markdown",
+			config:      "index_page_size: 1\n",
+			accept:      "text/markdown",
+			contentType: "text/markdown; charset=utf-8",
+			body: "# example.com\n\n" +
+				"- [example.com/foo](https://example.com/foo): https://github.com/example/foo\n\n" +
+				"Page 1 of 2 · [Next](?page=2)\n",
+		},
+		{
+			name:        "plain text",
+			accept:      "text/plain",
+			contentType: "text/plain; charset=utf-8",
+			body: "example.com/foo https://github.com/example/foo\n" +
+				"example.com/portmidi https://github.com/rakyll/portmidi\n",
+		},
+		{
+			name:        "browser",
+			accept:      "text/html,application/xhtml+xml,text/plain;q=0.8,*/*;q=0.7",
+			contentType: "text/html; charset=utf-8",
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte("host: example.com\n" + test.config + "paths:\n" +
+			"  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n" +
+			"  /foo:\n    repo: https://github.com/example/foo\n"))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", test.accept)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if got := w.Header().Get("Content-Type"); got != test.contentType {
+			t.Errorf("%s: Content-Type = %q; want %q", test.name, got, test.contentType)
+		}
+
+		if got := w.Header().Get("Vary"); got != "Accept" {
+			t.Errorf("%s: Vary = %q; want Accept", test.name, got)
+		}
+
+		if got := w.Body.String(); test.body != "" && got != test.body {
+			t.Errorf("%s: body = %q; want %q", test.name, got, test.body)
+		}
+	}
+}
+
+func TestIndexPagination(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		query  string
+		status int
+		paths  []string
+		links  []string
+	}{
+		{
+			name:   "disabled",
+			query:  "?page=2",
+			status: http.StatusOK,
+			paths:  []string{"/a", "/b", "/c"},
+		},
+		{
+			name:   "fits in a page",
+			config: "index_page_size: 3\n",
+			status: http.StatusOK,
+			paths:  []string{"/a", "/b", "/c"},
+		},
+		{
+			name:   "first page",
+			config: "index_page_size: 2\n",
+			status: http.StatusOK,
+			paths:  []string{"/a", "/b"},
+			links:  []string{`<?page=2>; rel="next"`},
+		},
+		{
+			name:   "last page",
+			config: "index_page_size: 2\n",
+			query:  "?page=2",
+			status: http.StatusOK,
+			paths:  []string{"/c"},
+			links:  []string{`<?page=1>; rel="prev"`},
+		},
+		{
+			name:   "per page",
+			config: "index_page_size: 2\n",
+			query:  "?page=2&per_page=1",
+			status: http.StatusOK,
+			paths:  []string{"/b"},
+			links:  []string{`<?page=1&per_page=1>; rel="prev"`, `<?page=3&per_page=1>; rel="next"`},
+		},
+		{
+			name:   "past the last page",
+			config: "index_page_size: 2\n",
+			query:  "?page=3",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "invalid page",
+			config: "index_page_size: 2\n",
+			query:  "?page=0",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid per page",
+			config: "index_page_size: 2\n",
+			query:  "?per_page=all",
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte("host: example.com\n" + test.config + "paths:\n" +
+			"  /a:\n    repo: https://github.com/example/a\n" +
+			"  /b:\n    repo: https://github.com/example/b\n" +
+			"  /c:\n    repo: https://github.com/example/c\n"))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/"+test.query, nil)
+		r.Header.Set("Accept", "text/plain")
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, test.status)
+			continue
+		}
+
+		if test.status != http.StatusOK {
+			continue
+		}
+
+		var want strings.Builder
+		for _, path := range test.paths {
+			fmt.Fprintf(&want, "example.com%s https://github.com/example%s\n", path, path)
+		}
+
+		if got := w.Body.String(); got != want.String() {
+			t.Errorf("%s: body = %q; want %q", test.name, got, want.String())
+		}
+
+		if got := w.Header().Values("Link"); !slices.Equal(got, test.links) {
+			t.Errorf("%s: Link = %q; want %q", test.name, got, test.links)
+		}
+	}
+}
+
+func TestIndexHits(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{
+			name: "hidden",
+		},
+		{
+			name:   "shown",
+			config: "show_hits: true\n",
+			want:   "(fetched 2 times since startup)",
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n" +
+			test.config))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		for _, path := range []string{"/portmidi", "/portmidi/foo", "/missing"} {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		}
+
+		if got := h.hits["/portmidi"].Load(); got != 2 {
+			t.Errorf("%s: hits = %d; want 2", test.name, got)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if got := strings.Contains(w.Body.String(), "fetched"); got != (test.want != "") {
+			t.Errorf("%s: index shows hits = %v; want %v", test.name, got, test.want != "")
+		}
+
+		if test.want != "" && !strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("%s: index = %q; want it to contain %q", test.name, w.Body.String(), test.want)
+		}
+	}
+}
+
+func TestNotFoundSuggestCase(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		path   string
+		accept string
+		body   string
+	}{
+		{
+			name: "disabled",
+			path: "/mypkg",
+			body: "404 page not found\n",
+		},
+		{
+			name:   "suggested",
+			config: "suggest_case: true\n",
+			path:   "/mypkg/sub",
+			body:   "404 page not found, did you mean example.com/MyPkg/sub?\n",
+		},
+		{
+			name:   "suggested as json",
+			config: "suggest_case: true\n",
+			path:   "/mypkg",
+			accept: "application/json",
+			body:   `{"error":"not found","path":"/mypkg","suggestion":"example.com/MyPkg"}` + "\n",
+		},
+		{
+			name:   "no segment boundary",
+			config: "suggest_case: true\n",
+			path:   "/mypkgs",
+			body:   "404 page not found\n",
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte("host: example.com\npaths:\n  /MyPkg:\n    repo: https://github.com/acme/mypkg\n" +
+			test.config))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		r := httptest.NewRequest(http.MethodGet, test.path, nil)
+		r.Header.Set("Accept", test.accept)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, http.StatusNotFound)
+		}
+
+		if got := w.Body.String(); got != test.body {
+			t.Errorf("%s: body = %q; want %q", test.name, got, test.body)
+		}
+	}
+}
+
+func TestStableIndex(t *testing.T) {
+	config := "host: example.com\n" +
+		"paths:\n" +
+		"  /foo:\n" +
+		"    repo: https://github.com/example/foo\n"
+
+	for _, path := range []string{"/zeta", "/alpha", "/mu", "/beta", "/omega", "/gamma", "/delta", "/pi"} {
+		config += "  " + path + ":\n    repo: https://github.com/example" + path + "\n"
+	}
+
+	render := func() (string, string) {
+		h, err := NewHandler([]byte(config))
+		if err != nil {
+			t.Fatalf("newHandler: %v", err)
+		}
+
+		index := httptest.NewRecorder()
+		h.ServeHTTP(index, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		vanity := httptest.NewRecorder()
+		h.ServeHTTP(vanity, httptest.NewRequest(http.MethodGet, "/foo", nil))
+
+		return index.Body.String(), vanity.Body.String()
+	}
+
+	wantIndex, wantVanity := render()
+
+	for i := 0; i < 20; i++ {
+		index, vanity := render()
+
+		if index != wantIndex {
+			t.Fatalf("index differs between reloads:\n%s\nwant:\n%s", index, wantIndex)
+		}
+
+		if vanity != wantVanity {
+			t.Fatalf("vanity differs between reloads:\n%s\nwant:\n%s", vanity, wantVanity)
+		}
+	}
+}
+
+func TestIndexAttribution(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   bool
+	}{
+		{
+			name: "default",
+		},
+		{
+			name:   "enabled",
+			config: "attribution: true\n",
+			want:   true,
+		},
+		{
+			name:   "disabled",
+			config: "attribution: false\n",
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n" +
+			test.config))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if got := strings.Contains(w.Body.String(), "Served by"); got != test.want {
+			t.Errorf("%s: attribution shown = %v; want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func BenchmarkVanityPage(b *testing.B) {
+	h, err := NewHandler([]byte("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	data := VanityTemplate{
+		Import:  "example.com/portmidi",
+		Repo:    "https://github.com/rakyll/portmidi",
+		Display: h.paths[0].Display,
+		VCS:     "git",
+		GoGet:   true,
+	}
+
+	// The templates used to be parsed on every request, rather than once by
+	// NewHandler.
+	b.Run("per request", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := parseTemplate("vanity.html.tmpl").Execute(io.Discard, data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("parsed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := h.vanityPage.Execute(io.Discard, data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkPathConfigSetFind(b *testing.B) {
+	// Many short configured prefixes that share a common start with, but are
+	// not prefixes of, a very long request path.
+	pset := make(PathConfigSet, 0, 10000)
+	for i := 0; i < cap(pset); i++ {
+		pset = append(pset, PathConfig{Path: fmt.Sprintf("/a%05d", i)})
+	}
+
+	pset = append(pset, PathConfig{Path: "/"})
+	sort.Sort(pset)
+
+	benchmarks := []struct {
+		name string
+		path string
+	}{
+		{name: "exact", path: "/a05000"},
+		{name: "subpath", path: "/a05000/" + strings.Repeat("x/", 50000)},
+		{name: "root", path: "/a" + strings.Repeat("z", 100000)},
+		{name: "long", path: "/" + strings.Repeat("a", 100000)},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if pc, _ := pset.find(bm.path); pc == nil {
+					b.Fatalf("find(%q) = nil", bm.path[:10])
+				}
+			}
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		refresh bool
+	}{
+		{
+			name:    "browser",
+			path:    "/portmidi",
+			refresh: true,
+		},
+		{
+			name: "go get",
+			path: "/portmidi?go-get=1",
+		},
+	}
+
+	h, err := NewHandler([]byte("go_get_only: false\npaths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if got := strings.Contains(w.Body.String(), `http-equiv="refresh"`); got != test.refresh {
+			t.Errorf("%s: refresh = %v; want %v", test.name, got, test.refresh)
+		}
+
+		if got := findMeta(w.Body.Bytes(), "go-import"); got == "" {
+			t.Errorf("%s: missing go-import meta", test.name)
+		}
+	}
+}
+
+func TestSplitVersion(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string
+		version string
+	}{
+		{path: "/mypkg", want: "/mypkg"},
+		{path: "/mypkg@v1.2.3", want: "/mypkg", version: "v1.2.3"},
+		{path: "/mypkg/sub@latest", want: "/mypkg/sub", version: "latest"},
+		{path: "/mypkg@", want: "/mypkg@"},
+		{path: "/mypkg@v1/sub", want: "/mypkg@v1/sub"},
+	}
+	for _, test := range tests {
+		got, version := splitVersion(test.path)
+		if got != test.want || version != test.version {
+			t.Errorf("splitVersion(%q) = %q, %q; want %q, %q", test.path, got, version, test.want, test.version)
+		}
+	}
+}
+
+func TestDocsRedirect(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		location string
+	}{
+		{
+			name:     "module",
+			path:     "/portmidi",
+			status:   http.StatusFound,
+			location: "https://pkg.go.dev/example.com/portmidi",
+		},
+		{
+			name:     "package at version",
+			path:     "/portmidi/foo@v1.2.3",
+			status:   http.StatusFound,
+			location: "https://pkg.go.dev/example.com/portmidi/foo@v1.2.3",
+		},
+		{
+			name:   "go get",
+			path:   "/portmidi/foo?go-get=1",
+			status: http.StatusOK,
+		},
+	}
+
+	h, err := NewHandler([]byte("host: example.com\ndocs_redirect: true\npaths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, test.status)
+		}
+
+		if got := w.Header().Get("Location"); got != test.location {
+			t.Errorf("%s: Location = %q; want %q", test.name, got, test.location)
+		}
+	}
+}
+
+func TestGodocHost(t *testing.T) {
+	h, err := NewHandler([]byte("host: example.com\ndocs_redirect: true\ngodoc_host: godocs.io\n" +
+		"paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/portmidi/foo", nil))
+
+	if got, want := w.Header().Get("Location"), "https://godocs.io/example.com/portmidi/foo"; w.Code != http.StatusFound || got != want {
+		t.Errorf("browser: %d %q; want %d %q", w.Code, got, http.StatusFound, want)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/portmidi/foo?go-get=1", nil))
+
+	if got, want := findMeta(w.Body.Bytes(), "go-import"), "example.com/portmidi git https://github.com/rakyll/portmidi"; w.Code != http.StatusOK || got != want {
+		t.Errorf("go get: %d, meta go-import = %q; want %d, %q", w.Code, got, http.StatusOK, want)
+	}
+
+	if _, err := NewHandler([]byte("godoc_host: https://godocs.io\npaths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n")); err != ErrInvalidGodocHost {
+		t.Errorf("godoc_host with a scheme: err = %v; want %v", err, ErrInvalidGodocHost)
+	}
+}
+
+func TestGroupIndex(t *testing.T) {
+	handlers := []IndexHandler{
+		{Import: "example.com/a", Repo: "https://github.com/acme/a"},
+		{Import: "example.com/b", Repo: "https://gitlab.com/group/b"},
+		{Import: "example.com/c", Repo: "https://github.com/other/c"},
+		{Import: "example.com/d", Repo: "https://github.com/acme/d"},
+	}
+
+	tests := []struct {
+		by   string
+		want map[string][]string
+	}{
+		{
+			by: "none",
+			want: map[string][]string{
+				"": {"example.com/a", "example.com/b", "example.com/c", "example.com/d"},
+			},
+		},
+		{
+			by: "provider",
+			want: map[string][]string{
+				"github.com": {"example.com/a", "example.com/c", "example.com/d"},
+				"gitlab.com": {"example.com/b"},
+			},
+		},
+		{
+			by: "org",
+			want: map[string][]string{
+				"github.com/acme":  {"example.com/a", "example.com/d"},
+				"github.com/other": {"example.com/c"},
+				"gitlab.com/group": {"example.com/b"},
+			},
+		},
+	}
+	for _, test := range tests {
+		groups := groupIndex(handlers, test.by)
+
+		got := make(map[string][]string)
+		for i, group := range groups {
+			if i > 0 && groups[i-1].Name >= group.Name {
+				t.Errorf("groupIndex(%q): groups not sorted: %q before %q", test.by, groups[i-1].Name, group.Name)
+			}
+
+			for _, handler := range group.Handlers {
+				got[group.Name] = append(got[group.Name], handler.Import)
+			}
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("groupIndex(%q) = %v; want %v", test.by, got, test.want)
+		}
+	}
+}
+
+func TestKeepAliveDuration(t *testing.T) {
+	enabled, disabled := true, false
+
+	tests := []struct {
+		keepalive KeepAlive
+		want      time.Duration
+	}{
+		{keepalive: KeepAlive{}, want: 0},
+		{keepalive: KeepAlive{Enabled: &enabled}, want: 0},
+		{keepalive: KeepAlive{Period: 30}, want: 30 * time.Second},
+		{keepalive: KeepAlive{Enabled: &disabled, Period: 30}, want: -1},
+	}
+	for _, test := range tests {
+		if got := test.keepalive.Duration(); got != test.want {
+			t.Errorf("%+v.Duration() = %v; want %v", test.keepalive, got, test.want)
+		}
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	configs := []string{
+		"paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n",
+		"index_redirect: https://acme.dev\nroot_module:\n  repo: https://github.com/rakyll/portmidi\n",
+		"index_path: /_index\nroot_module:\n  repo: https://github.com/rakyll/portmidi\n",
+	}
+	for _, config := range configs {
+		h, err := NewHandler([]byte(config))
+		if err != nil {
+			t.Errorf("newHandler: %v", err)
+			continue
+		}
+
+		if err := h.SelfTest(); err != nil {
+			t.Errorf("SelfTest() = %v; want nil for config:\n%s", err, config)
+		}
+	}
+}
+
+func TestNegativeMaxAge(t *testing.T) {
+	h, err := NewHandler([]byte("cache_max_age: 3600\n" +
+		"negative_max_age:\n  /experimental: 60\n  /experimental/unstable: 5\n" +
+		"paths:\n  /experimental/portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	tests := []struct {
+		path         string
+		status       int
+		cacheControl string
+	}{
+		{"/experimental/portmidi/foo?go-get=1", http.StatusOK, "public, max-age=3600"},
+		{"/experimental/gone", http.StatusNotFound, "public, max-age=60"},
+		{"/experimental", http.StatusNotFound, "public, max-age=60"},
+		{"/experimental/unstable/gone", http.StatusNotFound, "public, max-age=5"},
+		{"/experimentalgone", http.StatusNotFound, "public, max-age=3600"},
+		{"/gone", http.StatusNotFound, "public, max-age=3600"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d; want %d", test.path, w.Code, test.status)
+		}
+
+		if got := w.Header().Get("Cache-Control"); got != test.cacheControl {
+			t.Errorf("%s: Cache-Control = %q; want %q", test.path, got, test.cacheControl)
+		}
+	}
+}
+
+func TestNewHandlerFromConfig(t *testing.T) {
+	want, err := NewHandler([]byte("host: example.com\ndefault_branch: main\npaths:\n" +
+		"  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n" +
+		"  /gopdf:\n    repo: https://bitbucket.org/zombiezen/gopdf\n    vcs: hg\n"))
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+
+	h, err := NewHandlerFromConfig(&Config{
+		Host:          "example.com",
+		DefaultBranch: "main",
+		Paths: Paths{
+			{Path: "/portmidi", Repo: "https://github.com/rakyll/portmidi"},
+			{Path: "/gopdf", Repo: "https://bitbucket.org/zombiezen/gopdf", VCS: "hg"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewHandlerFromConfig: %v", err)
+	}
+
+	if !reflect.DeepEqual(h.PathConfigs(), want.PathConfigs()) {
+		t.Errorf("paths = %+v; want %+v", h.PathConfigs(), want.PathConfigs())
+	}
+
+	tests := []struct {
+		name   string
+		config Config
+		err    error
+	}{
+		{
+			name:   "invalid setting",
+			config: Config{UnknownQuery: "drop"},
+			err:    ErrInvalidUnknownQuery,
+		},
+		{
+			name:   "invalid browse_target",
+			config: Config{BrowseTarget: "github"},
+			err:    ErrInvalidBrowseTarget,
+		},
+		{
+			name:   "missing path",
+			config: Config{Paths: Paths{{Repo: "https://github.com/rakyll/portmidi"}}},
+			err:    ErrPathMissing,
+		},
+	}
+	for _, test := range tests {
+		if _, err := NewHandlerFromConfig(&test.config); !errors.Is(err, test.err) {
+			t.Errorf("%s: NewHandlerFromConfig = %v; want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestParseConfigFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		format string
+		err    error
+	}{
+		{
+			name:   "yaml",
+			config: "paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n",
+			format: "yaml",
+		},
+		{
+			name:   "json",
+			config: `{"paths": {"/portmidi": {"repo": "https://github.com/rakyll/portmidi"}}}`,
+			format: "json",
+		},
+		{
+			name:   "toml",
+			config: "[paths.\"/portmidi\"]\nrepo = \"https://github.com/rakyll/portmidi\"\n",
+			format: "toml",
+		},
+		{
+			name:   "toml list",
+			config: "[[paths]]\npath = \"/portmidi\"\nrepo = \"https://github.com/rakyll/portmidi\"\n",
+			format: "toml",
+		},
+		{
+			name:   "yaml as toml",
+			config: "paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n",
+			format: "toml",
+			err:    ErrInvalidConfig,
+		},
+		{
+			name:   "json as yaml",
+			config: `{"paths": {"/portmidi": {"repo": "https://github.com/rakyll/portmidi"}}}`,
+			format: "yaml",
+		},
+		{
+			name:   "yaml as json",
+			config: "paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n",
+			format: "json",
+			err:    ErrInvalidConfig,
+		},
+		{
+			name:   "unknown format",
+			config: "{}",
+			format: "ini",
+			err:    ErrInvalidConfigFormat,
+		},
+	}
+	for _, test := range tests {
+		parsed, err := ParseConfigFormat([]byte(test.config), test.format)
+		if err != test.err {
+			t.Errorf("%s: err = %v; want %v", test.name, err, test.err)
+			continue
+		}
+
+		if err == nil && (len(parsed.Paths) != 1 || parsed.Paths[0].Repo != "https://github.com/rakyll/portmidi") {
+			t.Errorf("%s: paths = %+v", test.name, parsed.Paths)
+		}
+	}
+}
+
+func TestParseConfigJSON(t *testing.T) {
+	// Every key of Config and of its nested structs, with the paths as a list
+	// so that "path" is set too.
+	const config = `host: example.com
+require_host: true
+import_host: go.example.com
+cache_max_age: 3600
+default_branch: main
+providers:
+  gitlab:
+    branch: trunk
+    dir_template: "{repo}/-/tree/{branch}{/dir}"
+    file_template: "{repo}/-/blob/{branch}{/dir}/{file}#L{line}"
+    hosts: [gitlab.example.com]
+shutdown_delay: 5
+drain_timeout: 20
+max_requests: 1000
+read_timeout: 10
+conn_max_age: 300
+max_conns_per_ip: 16
+debug_headers: true
+hsts_preload: true
+tls_cert_file: cert.pem
+tls_key_file: key.pem
+tls:
+  cipher_suites: [TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256]
+  curves: [X25519]
+http3: true
+trace_context: true
+snapshot_file: hits.json
+robots_txt: "User-agent: *\n"
+show_hits: true
+suggest_case: true
+attribution: true
+docs_redirect: true
+godoc_host: godocs.io
+index_group_by: org
+index_page_size: 50
+keepalive:
+  enabled: true
+  period: 30
+index_path: /_index
+index_redirect: https://example.com/docs
+root_behavior: redirect
+unknown_query: redirect
+body_template: "{{.Repo}}"
+error_template: "{{.Status}}"
+subpath_separator: "~"
+go_get_only: false
+browse_target: index
+collapse_slashes: true
+index_template: index.html
+vanity_template: vanity.html
+root_module:
+  repo: https://github.com/example/root
+provider_prefix_mode:
+  gh: github.com
+negative_max_age:
+  /experimental: 60
+display_template: "{{.Repo}} {{.Repo}}/tree/{{.Branch}}{/dir} {{.Repo}}/blob/{{.Branch}}{/dir}/{file}#L{line}"
+trusted_proxies: [10.0.0.0/8]
+paths:
+  - path: /portmidi
+    repo: https://git.example.com/rakyll/portmidi.git
+    source_repo: https://github.com/rakyll/portmidi
+    display: https://github.com/rakyll/portmidi _ _
+    vcs: git
+    branch: stable
+    cache_max_age: 60
+    dir_template: "{repo}/tree/{branch}{/dir}"
+    file_template: "{repo}/blob/{branch}{/dir}/{file}#L{line}"
+    display_template: "{{.Repo}} _ _"
+`
+
+	var doc any
+	if err := yaml.Unmarshal([]byte(config), &doc); err != nil {
+		t.Fatalf("yaml.Unmarshal: %v", err)
+	}
+
+	keys := make(map[string]bool)
+	collectKeys(doc, keys)
+
+	for _, key := range yamlKeys(reflect.TypeOf(Config{})) {
+		if !keys[key] {
+			t.Errorf("config doesn't set %q", key)
+		}
+	}
+
+	jsonConfig, err := json.Marshal(jsonValue(doc))
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+
+	want, err := ParseConfigFormat([]byte(config), "yaml")
+	if err != nil {
+		t.Fatalf("ParseConfigFormat(yaml): %v", err)
+	}
+
+	got, err := ParseConfigFormat(jsonConfig, "json")
+	if err != nil {
+		t.Fatalf("ParseConfigFormat(json): %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON config = %+v; want %+v", got, want)
+	}
+}
+
+// yamlKeys returns the YAML keys of the fields of the struct typ, and of the
+// structs nested in them.
+func yamlKeys(typ reflect.Type) []string {
+	var keys []string
+
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" {
+			continue
+		}
+
+		keys = append(keys, name)
+
+		elem := field.Type
+		for elem.Kind() == reflect.Pointer || elem.Kind() == reflect.Slice || elem.Kind() == reflect.Map {
+			elem = elem.Elem()
+		}
+
+		if elem.Kind() == reflect.Struct {
+			keys = append(keys, yamlKeys(elem)...)
+		}
+	}
+
+	return keys
+}
+
+// collectKeys adds the keys of every mapping of the YAML document v to keys.
+func collectKeys(v any, keys map[string]bool) {
+	switch v := v.(type) {
+	case map[any]any:
+		for k, e := range v {
+			keys[fmt.Sprint(k)] = true
+			collectKeys(e, keys)
+		}
+	case []any:
+		for _, e := range v {
+			collectKeys(e, keys)
+		}
+	}
+}
+
+// jsonValue converts the YAML document v to a value encoding/json accepts.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+
+		return m
+	case []any:
+		for i, e := range v {
+			v[i] = jsonValue(e)
+		}
+
+		return v
+	default:
+		return v
+	}
+}
+
+func TestCacheHeader(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		cacheControl string
+	}{
+		{
+			name:         "default",
+			cacheControl: "public, max-age=86400",
+		},
+		{
+			name:         "specify time",
+			config:       "cache_max_age: 60\n",
+			cacheControl: "public, max-age=60",
+		},
+		{
+			name:         "zero",
+			config:       "cache_max_age: 0\n",
+			cacheControl: "public, max-age=0",
+		},
+		{
+			name:         "path override",
+			config:       "    cache_max_age: 604800\n",
+			cacheControl: "public, max-age=604800",
+		},
+		{
+			name:         "path zero over global",
+			config:       "    cache_max_age: 0\ncache_max_age: 60\n",
+			cacheControl: "public, max-age=0",
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n" +
+			test.config))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+		s := httptest.NewServer(h)
+		resp, err := http.Get(s.URL + "/portmidi")
+		if err != nil {
+			t.Errorf("%s: http.Get: %v", test.name, err)
+			continue
+		}
+		resp.Body.Close()
+		got := resp.Header.Get("Cache-Control")
+		if got != test.cacheControl {
+			t.Errorf("%s: Cache-Control header = %q; want %q", test.name, got, test.cacheControl)
+		}
+	}
+}
+
+func TestPathCacheMaxAgeNegative(t *testing.T) {
+	_, err := NewHandler([]byte("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n    cache_max_age: -1\n"))
+
+	var ageErr *InvalidCacheMaxAgeError
+	if !errors.As(err, &ageErr) || !strings.Contains(err.Error(), "/portmidi") {
+		t.Errorf("NewHandler = %v; want an InvalidCacheMaxAgeError naming /portmidi", err)
+	}
+}
+
+func TestDuplicatePath(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{
+			name:   "map",
+			config: "paths:\n  /foo:\n    repo: https://github.com/example/foo\n  /foo/:\n    repo: https://github.com/example/foo-mirror\n",
+			want:   "configuration for /foo/: same path as /foo",
+		},
+		{
+			name:   "list ordered by priority",
+			config: "paths:\n  - path: /foo/\n    repo: https://github.com/example/foo\n  - path: /foo\n    repo: https://github.com/example/foo-mirror\n",
+		},
+	}
+	for _, test := range tests {
+		_, err := NewHandler([]byte(test.config))
+
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("%s: NewHandler = %v; want nil", test.name, err)
+			}
+
+			continue
+		}
+
+		var dupErr *DuplicatePathError
+		if !errors.As(err, &dupErr) || err.Error() != test.want {
+			t.Errorf("%s: NewHandler = %v; want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestRootModule(t *testing.T) {
+	config := "host: example.com\n" +
+		"index_path: /_index\n" +
+		"root_module:\n" +
+		"  repo: https://github.com/example/example\n" +
+		"paths:\n" +
+		"  /tools:\n" +
+		"    repo: https://github.com/example/tools\n"
+
+	tests := []struct {
+		name     string
+		path     string
+		goImport string
+		index    bool
+	}{
+		{
+			name:     "root",
+			path:     "/",
+			goImport: "example.com git https://github.com/example/example",
+		},
+		{
+			name:     "package",
+			path:     "/foo/bar",
+			goImport: "example.com git https://github.com/example/example",
+		},
+		{
+			name:     "nested module",
+			path:     "/tools/cmd",
+			goImport: "example.com/tools git https://github.com/example/tools",
+		},
+		{
+			name:  "index",
+			path:  "/_index",
+			index: true,
+		},
+	}
+
+	h, err := NewHandler([]byte(config))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path+"?go-get=1", nil))
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, http.StatusOK)
+		}
+
+		if got := findMeta(w.Body.Bytes(), "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.name, got, test.goImport)
+		}
+
+		if got := strings.Contains(w.Body.String(), "<h1>example.com</h1>"); got != test.index {
+			t.Errorf("%s: index = %v; want %v", test.name, got, test.index)
+		}
+	}
+}
+
+func TestMajorVersionRoots(t *testing.T) {
+	config := "host: example.com\n" +
+		"paths:\n" +
+		"  /mypkg:\n" +
+		"    repo: https://github.com/example/mypkg\n" +
+		"  /mypkg/v2:\n" +
+		"    repo: https://github.com/example/mypkg\n" +
+		"    branch: v2\n"
+
+	tests := []struct {
+		path     string
+		goImport string
+		goSource string
+	}{
+		{
+			path:     "/mypkg/sub",
+			goImport: "example.com/mypkg git https://github.com/example/mypkg",
+			goSource: "example.com/mypkg https://github.com/example/mypkg https://github.com/example/mypkg/tree/master{/dir} https://github.com/example/mypkg/blob/master{/dir}/{file}#L{line}",
+		},
+		{
+			path:     "/mypkg/v2",
+			goImport: "example.com/mypkg/v2 git https://github.com/example/mypkg",
+			goSource: "example.com/mypkg/v2 https://github.com/example/mypkg https://github.com/example/mypkg/tree/v2{/dir} https://github.com/example/mypkg/blob/v2{/dir}/{file}#L{line}",
+		},
+		{
+			path:     "/mypkg/v2/sub",
+			goImport: "example.com/mypkg/v2 git https://github.com/example/mypkg",
+			goSource: "example.com/mypkg/v2 https://github.com/example/mypkg https://github.com/example/mypkg/tree/v2{/dir} https://github.com/example/mypkg/blob/v2{/dir}/{file}#L{line}",
+		},
+		{
+			path:     "/mypkg/v3",
+			goImport: "example.com/mypkg git https://github.com/example/mypkg",
+			goSource: "example.com/mypkg https://github.com/example/mypkg https://github.com/example/mypkg/tree/master{/dir} https://github.com/example/mypkg/blob/master{/dir}/{file}#L{line}",
+		},
+	}
+
+	h, err := NewHandler([]byte(config))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path+"?go-get=1", nil))
+
+		if got := findMeta(w.Body.Bytes(), "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.path, got, test.goImport)
+		}
+
+		if got := findMeta(w.Body.Bytes(), "go-source"); got != test.goSource {
+			t.Errorf("%s: meta go-source = %q; want %q", test.path, got, test.goSource)
+		}
+	}
+}
+
+func TestIndexRedirect(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		location string
+	}{
+		{
+			name:     "index",
+			path:     "/",
+			status:   http.StatusFound,
+			location: "https://acme.dev",
+		},
+		{
+			name:   "module",
+			path:   "/portmidi",
+			status: http.StatusOK,
+		},
+	}
+
+	h, err := NewHandler([]byte("index_redirect: https://acme.dev\ngo_get_only: false\npaths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, test.status)
+		}
+
+		if got := w.Header().Get("Location"); got != test.location {
+			t.Errorf("%s: Location = %q; want %q", test.name, got, test.location)
+		}
+	}
+}
+
+func TestRootBehavior(t *testing.T) {
+	tests := []struct {
+		name     string
+		behavior string
+		path     string
+		status   int
+		location string
+		goImport string
+		index    bool
+	}{
+		{
+			name:     "default",
+			path:     "/",
+			status:   http.StatusOK,
+			goImport: "example.com git https://github.com/example/example",
+		},
+		{
+			name:     "vanity",
+			behavior: "vanity",
+			path:     "/",
+			status:   http.StatusOK,
+			goImport: "example.com git https://github.com/example/example",
+		},
+		{
+			name:     "index",
+			behavior: "index",
+			path:     "/",
+			status:   http.StatusOK,
+			index:    true,
+		},
+		{
+			name:     "index for go get",
+			behavior: "index",
+			path:     "/?go-get=1",
+			status:   http.StatusOK,
+			goImport: "example.com git https://github.com/example/example",
+		},
+		{
+			name:     "redirect",
+			behavior: "redirect",
+			path:     "/",
+			status:   http.StatusFound,
+			location: "https://github.com/example/example",
+		},
+		{
+			name:     "redirect subpath",
+			behavior: "redirect",
+			path:     "/foo",
+			status:   http.StatusOK,
+			goImport: "example.com git https://github.com/example/example",
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte("host: example.com\ngo_get_only: false\nroot_behavior: " + test.behavior + "\n" +
+			"paths:\n  /:\n    repo: https://github.com/example/example\n"))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, test.status)
+		}
+
+		if got := w.Header().Get("Location"); got != test.location {
+			t.Errorf("%s: Location = %q; want %q", test.name, got, test.location)
+		}
+
+		if got := findMeta(w.Body.Bytes(), "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.name, got, test.goImport)
+		}
+
+		if got := strings.Contains(w.Body.String(), "<h1>example.com</h1>"); got != test.index {
+			t.Errorf("%s: index = %v; want %v", test.name, got, test.index)
+		}
+	}
+}
+
+func TestUnknownQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		config   string
+		path     string
+		status   int
+		location string
+	}{
+		{
+			name:   "ignore",
+			path:   "/portmidi?go-get=1&cb=123",
+			status: http.StatusOK,
+		},
+		{
+			name:     "redirect",
+			mode:     "redirect",
+			path:     "/portmidi/foo?cb=123&go-get=1",
+			status:   http.StatusMovedPermanently,
+			location: "/portmidi/foo?go-get=1",
+		},
+		{
+			name:     "redirect without go-get",
+			mode:     "redirect",
+			path:     "/portmidi?cb=123",
+			status:   http.StatusMovedPermanently,
+			location: "/portmidi",
+		},
+		{
+			name:     "redirect with leading slashes",
+			mode:     "redirect",
+			path:     "//evil.example/x?utm=1",
+			status:   http.StatusMovedPermanently,
+			location: "/evil.example/x",
+		},
+		{
+			name:   "redirect canonical",
+			mode:   "redirect",
+			path:   "/portmidi?go-get=1",
+			status: http.StatusOK,
+		},
+		{
+			name:   "reject percent-encoded go-get",
+			mode:   "reject",
+			path:   "/portmidi?go-get=%31",
+			status: http.StatusOK,
+		},
+		{
+			name:   "reject reordered page parameters",
+			mode:   "reject",
+			config: "index_page_size: 1\n",
+			path:   "/?per_page=1&page=1",
+			status: http.StatusOK,
+		},
+		{
+			name:   "reject page parameters without pagination",
+			mode:   "reject",
+			path:   "/?per_page=1&page=2",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "redirect reordered page parameters",
+			mode:   "redirect",
+			config: "index_page_size: 1\n",
+			path:   "/?per_page=1&page=1",
+			status: http.StatusOK,
+		},
+		{
+			name:   "reject",
+			mode:   "reject",
+			path:   "/portmidi?go-get=1&cb=123",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "reject canonical",
+			mode:   "reject",
+			path:   "/portmidi?go-get=1",
+			status: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte("host: example.com\nunknown_query: " + test.mode + "\n" + test.config +
+			"paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, test.status)
+		}
+
+		if got := w.Header().Get("Location"); got != test.location {
+			t.Errorf("%s: Location = %q; want %q", test.name, got, test.location)
+		}
+	}
+}
+
+func TestBodyTemplate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{
+			name: "default",
+			want: `Redirecting to <a href="https://github.com/rakyll/portmidi">https://github.com/rakyll/portmidi</a> ...`,
+		},
+		{
+			name:   "custom",
+			config: "body_template: 'Weiterleitung zu <a href=\"{{.Repo}}\">{{.Import | upper}}</a>'\n",
+			want:   `Weiterleitung zu <a href="https://github.com/rakyll/portmidi">EXAMPLE.COM/PORTMIDI</a>`,
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte("host: example.com\ngo_get_only: false\n" + test.config +
+			"paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/portmidi", nil))
+
+		if !strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("%s: body = %q; want it to contain %q", test.name, w.Body.String(), test.want)
+		}
+
+		if got, want := findMeta(w.Body.Bytes(), "go-import"), "example.com/portmidi git https://github.com/rakyll/portmidi"; got != want {
+			t.Errorf("%s: meta go-import = %q; want %q", test.name, got, want)
+		}
+	}
+}
+
+func TestErrorTemplate(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tests := []struct {
+		name        string
+		config      string
+		accept      string
+		contentType string
+		want        string
+	}{
+		{
+			name:        "default",
+			contentType: "text/html; charset=utf-8",
+			want:        "<h1>500 Internal Server Error</h1>",
+		},
+		{
+			name:        "request id",
+			config:      "trace_context: true\n",
+			contentType: "text/html; charset=utf-8",
+			want:        "Request ID: <code>4bf92f3577b34da6a3ce929d0e0e4736</code>",
+		},
+		{
+			name:        "json",
+			config:      "trace_context: true\n",
+			accept:      "application/json",
+			contentType: "application/json",
+			want:        `{"error":"error rendering HTTP response","request_id":"4bf92f3577b34da6a3ce929d0e0e4736"}`,
+		},
+		{
+			name:        "custom",
+			config:      "error_template: '{{.Status}}: {{.Error | upper}}'\n",
+			contentType: "text/html; charset=utf-8",
+			want:        "500: ERROR RENDERING HTTP RESPONSE",
+		},
+		{
+			name:        "failing error template",
+			config:      "error_template: '{{.Nope}}'\n",
+			contentType: "text/plain; charset=utf-8",
+			want:        "error rendering HTTP response",
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte("host: example.com\ngo_get_only: false\nbody_template: '{{.Nope}}'\n" + test.config +
+			"paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/portmidi", nil)
+		r.Header.Set("traceparent", traceparent)
+		r.Header.Set("Accept", test.accept)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, http.StatusInternalServerError)
+		}
+
+		if got := w.Header().Get("Content-Type"); got != test.contentType {
+			t.Errorf("%s: Content-Type = %q; want %q", test.name, got, test.contentType)
+		}
+
+		if got := w.Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("%s: Cache-Control = %q; want no-store", test.name, got)
+		}
+
+		if got := w.Body.String(); !strings.Contains(got, test.want) {
+			t.Errorf("%s: body = %q; want it to contain %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTemplateFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"index.html": `<h1>Acme modules</h1>{{range .Handlers}}<p>{{.Import}}</p>{{end}}`,
+		"vanity.html": `<html><head><meta name="go-import" content="{{.Import}} {{.VCS}} {{.Repo}}"></head>` +
+			`<body>Acme module {{.Import}}</body></html>`,
+		"broken.html":   `{{.Import`,
+		"noimport.html": `<html><body>{{.Import}}</body></html>`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const paths = "paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"
+
+	h, err := NewHandler([]byte("host: example.com\ngo_get_only: false\n" +
+		"index_template: " + filepath.Join(dir, "index.html") + "\n" +
+		"vanity_template: " + filepath.Join(dir, "vanity.html") + "\n" + paths))
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if want := "<h1>Acme modules</h1><p>example.com/portmidi</p>"; w.Body.String() != want {
+		t.Errorf("index = %q; want %q", w.Body.String(), want)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/portmidi?go-get=1", nil))
+
+	if want := "Acme module example.com/portmidi"; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("vanity page = %q; want it to contain %q", w.Body.String(), want)
+	}
+
+	if got, want := findMeta(w.Body.Bytes(), "go-import"), "example.com/portmidi git https://github.com/rakyll/portmidi"; got != want {
+		t.Errorf("meta go-import = %q; want %q", got, want)
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		err    error
+	}{
+		{
+			name:   "missing file",
+			config: "vanity_template: " + filepath.Join(dir, "missing.html") + "\n",
+			err:    fs.ErrNotExist,
+		},
+		{
+			name:   "parse error",
+			config: "index_template: " + filepath.Join(dir, "broken.html") + "\n",
+		},
+		{
+			name:   "without go-import",
+			config: "vanity_template: " + filepath.Join(dir, "noimport.html") + "\n",
+			err:    ErrGoImportMissing,
+		},
+	}
+	for _, test := range tests {
+		_, err := NewHandler([]byte(test.config + paths))
+
+		var fileErr *InvalidTemplateFileError
+		if !errors.As(err, &fileErr) || (test.err != nil && !errors.Is(err, test.err)) {
+			t.Errorf("%s: NewHandler = %v; want an InvalidTemplateFileError wrapping %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	h, err := NewHandler([]byte("go_get_only: false\npaths:\n" +
+		"  /portmidi:\n" +
+		"    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	for _, path := range []string{"/", "/portmidi"} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Host = `example.com"><script>alert(1)</script>`
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if body := w.Body.String(); strings.Contains(body, "<script>") || !strings.Contains(body, "example.com&#34;&gt;&lt;script&gt;") {
+			t.Errorf("%s: body = %q; want the host escaped", path, body)
+		}
+	}
+}
+
+func TestGoGetOnly(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		path      string
+		userAgent string
+		status    int
+		location  string
+		goImport  string
+	}{
+		{
+			name:     "default",
+			path:     "/portmidi",
+			status:   http.StatusFound,
+			location: "https://pkg.go.dev/example.com/portmidi",
+		},
+		{
+			name:     "disabled",
+			config:   "go_get_only: false\n",
+			path:     "/portmidi",
+			status:   http.StatusOK,
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+		},
+		{
+			name:     "browser",
+			config:   "go_get_only: true\n",
+			path:     "/portmidi/foo@v1.0.0",
+			status:   http.StatusFound,
+			location: "https://pkg.go.dev/example.com/portmidi/foo@v1.0.0",
+		},
+		{
+			name:     "browser to the index",
+			config:   "go_get_only: true\nbrowse_target: index\n",
+			path:     "/portmidi/foo",
+			status:   http.StatusFound,
+			location: "/",
+		},
+		{
+			name:     "browser to the repo",
+			config:   "go_get_only: true\nbrowse_target: repo\n",
+			path:     "/portmidi",
+			status:   http.StatusFound,
+			location: "https://github.com/rakyll/portmidi",
+		},
+		{
+			name:     "browser subpath",
+			config:   "go_get_only: true\nbrowse_target: repo\n",
+			path:     "/portmidi/foo/bar",
+			status:   http.StatusFound,
+			location: "https://github.com/rakyll/portmidi/tree/master/foo/bar",
+		},
+		{
+			name:     "browser subpath without display",
+			config:   "go_get_only: true\nbrowse_target: repo\n",
+			path:     "/opaque/foo",
+			status:   http.StatusFound,
+			location: "https://git.example.com/opaque",
+		},
+		{
+			name:     "go-get",
+			config:   "go_get_only: true\n",
+			path:     "/portmidi/foo?go-get=1",
+			status:   http.StatusOK,
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+		},
+		{
+			name:      "go user agent",
+			config:    "go_get_only: true\n",
+			path:      "/portmidi",
+			userAgent: "Go-http-client/1.1",
+			status:    http.StatusOK,
+			goImport:  "example.com/portmidi git https://github.com/rakyll/portmidi",
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte("host: example.com\n" + test.config +
+			"paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n" +
+			"  /opaque:\n    repo: https://git.example.com/opaque\n    vcs: git\n"))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		r := httptest.NewRequest(http.MethodGet, test.path, nil)
+		r.Header.Set("User-Agent", test.userAgent)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, test.status)
+		}
+
+		if got := w.Header().Get("Location"); got != test.location {
+			t.Errorf("%s: Location = %q; want %q", test.name, got, test.location)
+		}
+
+		if got := findMeta(w.Body.Bytes(), "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.name, got, test.goImport)
+		}
+	}
+}
+
+func TestHostMissing(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		status int
+	}{
+		{
+			name:   "request host",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "configured host",
+			config: "host: example.com\n",
+			status: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte(test.config + "paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		for _, path := range []string{"/", "/portmidi?go-get=1"} {
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			r.Host = ""
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Errorf("%s: %s: status = %d; want %d", test.name, path, w.Code, test.status)
+			}
+
+			if test.status == http.StatusBadRequest && w.Body.String() != ErrHTTPHostMissing.Error()+"\n" {
+				t.Errorf("%s: %s: body = %q; want %q", test.name, path, w.Body.String(), ErrHTTPHostMissing.Error())
+			}
+		}
+	}
+}
+
+func TestRequireHost(t *testing.T) {
+	if _, err := NewHandler([]byte("require_host: true\n")); err != ErrHTTPHostMissing {
+		t.Errorf("without host: err = %v; want %v", err, ErrHTTPHostMissing)
+	}
+
+	if _, err := NewHandler([]byte("require_host: true\nhost: example.com\n")); err != nil {
+		t.Errorf("with host: err = %v; want nil", err)
+	}
+}
+
+func TestImportHost(t *testing.T) {
+	h, err := NewHandler([]byte("import_host: go.example.com\ndocs_redirect: true\n" +
+		"paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://vanity.internal/portmidi/foo?go-get=1", nil))
+
+	if got, want := findMeta(w.Body.Bytes(), "go-import"), "go.example.com/portmidi git https://github.com/rakyll/portmidi"; got != want {
+		t.Errorf("meta go-import = %q; want %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://vanity.internal/portmidi/foo", nil))
+
+	if got, want := w.Header().Get("Location"), "https://pkg.go.dev/go.example.com/portmidi/foo"; got != want {
+		t.Errorf("docs redirect = %q; want %q", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://vanity.internal/", nil))
+
+	if want := `<a href="https://vanity.internal/portmidi">go.example.com/portmidi</a>`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("index = %q; want it to contain %q", w.Body.String(), want)
+	}
+}
+
+func TestImportHostPort(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		host     string
+		goImport string
+		index    string
+	}{
+		{
+			name:     "any host",
+			host:     "go.acme.dev:8443",
+			goImport: "go.acme.dev/portmidi git https://github.com/rakyll/portmidi",
+			index:    `<a href="https://go.acme.dev:8443/portmidi">go.acme.dev/portmidi</a>`,
+		},
+		{
+			name:     "any host without port",
+			host:     "go.acme.dev",
+			goImport: "go.acme.dev/portmidi git https://github.com/rakyll/portmidi",
+			index:    `<a href="https://go.acme.dev/portmidi">go.acme.dev/portmidi</a>`,
+		},
+		{
+			name:     "ipv6",
+			host:     "[::1]:8080",
+			goImport: "[::1]/portmidi git https://github.com/rakyll/portmidi",
+			index:    `<a href="https://[::1]:8080/portmidi">[::1]/portmidi</a>`,
+		},
+		{
+			name:     "ipv6 without port",
+			host:     "[::1]",
+			goImport: "[::1]/portmidi git https://github.com/rakyll/portmidi",
+			index:    `<a href="https://[::1]/portmidi">[::1]/portmidi</a>`,
+		},
+		{
+			name:     "configured host",
+			config:   "host: go.acme.dev\n",
+			host:     "localhost:8080",
+			goImport: "go.acme.dev/portmidi git https://github.com/rakyll/portmidi",
+			index:    `<a href="https://go.acme.dev/portmidi">go.acme.dev/portmidi</a>`,
+		},
+		{
+			name:     "configured host with port",
+			config:   "host: go.acme.dev:8443\n",
+			host:     "go.acme.dev:8443",
+			goImport: "go.acme.dev:8443/portmidi git https://github.com/rakyll/portmidi",
+			index:    `<a href="https://go.acme.dev:8443/portmidi">go.acme.dev:8443/portmidi</a>`,
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte(test.config + "paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/portmidi?go-get=1", nil)
+		r.Host = test.host
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if got := findMeta(w.Body.Bytes(), "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.name, got, test.goImport)
+		}
+
+		r = httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = test.host
+
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if !strings.Contains(w.Body.String(), test.index) {
+			t.Errorf("%s: index = %q; want it to contain %q", test.name, w.Body.String(), test.index)
+		}
+	}
+}
+
+func TestCollapseSlashes(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		path     string
+		status   int
+		location string
+		goImport string
+	}{
+		{
+			name:   "disabled",
+			path:   "//portmidi",
+			status: http.StatusNotFound,
+		},
+		{
+			name:     "leading",
+			config:   "collapse_slashes: true\n",
+			path:     "//portmidi",
+			status:   http.StatusMovedPermanently,
+			location: "/portmidi",
+		},
+		{
+			name:     "inner and trailing",
+			config:   "collapse_slashes: true\n",
+			path:     "/portmidi//sub//?foo=bar",
+			status:   http.StatusMovedPermanently,
+			location: "/portmidi/sub/?foo=bar",
+		},
+		{
+			name:     "go-get",
+			config:   "collapse_slashes: true\n",
+			path:     "//portmidi//sub?go-get=1",
+			status:   http.StatusOK,
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+		},
+		{
+			name:     "trailing",
+			config:   "collapse_slashes: true\n",
+			path:     "/portmidi/?go-get=1",
+			status:   http.StatusOK,
+			goImport: "example.com/portmidi git https://github.com/rakyll/portmidi",
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte("host: example.com\n" + test.config +
+			"paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		// The path is set afterwards, as a leading "//" would be parsed as
+		// the host.
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.URL.Path, r.URL.RawQuery, _ = strings.Cut(test.path, "?")
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d; want %d", test.name, w.Code, test.status)
+		}
+
+		if got := w.Header().Get("Location"); got != test.location {
+			t.Errorf("%s: Location = %q; want %q", test.name, got, test.location)
+		}
+
+		if got := findMeta(w.Body.Bytes(), "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.name, got, test.goImport)
+		}
+	}
+}
+
+func TestDebugHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		path    string
+		headers map[string]string
+	}{
+		{
+			name: "disabled",
+			path: "/portmidi/foo",
+			headers: map[string]string{
+				"X-Vanity-Path":    "",
+				"X-Vanity-Subpath": "",
+				"X-Vanity-Repo":    "",
+			},
+		},
+		{
+			name:   "vanity",
+			config: "debug_headers: true\n",
+			path:   "/portmidi/foo",
+			headers: map[string]string{
+				"X-Vanity-Path":    "/portmidi",
+				"X-Vanity-Subpath": "foo",
+				"X-Vanity-Repo":    "https://github.com/rakyll/portmidi",
+			},
+		},
+		{
+			name:   "index",
+			config: "debug_headers: true\n",
+			path:   "/",
+			headers: map[string]string{
+				"X-Vanity-Path": "",
+				"X-Vanity-Repo": "",
+			},
+		},
+		{
+			name:   "not found",
+			config: "debug_headers: true\n",
+			path:   "/missing",
+			headers: map[string]string{
+				"X-Vanity-Path": "",
+				"X-Vanity-Repo": "",
+			},
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n" +
+			test.config))
+		if err != nil {
+			t.Errorf("%s: newHandler: %v", test.name, err)
+			continue
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		for key, want := range test.headers {
+			if got := w.Header().Get(key); got != want {
+				t.Errorf("%s: %s header = %q; want %q", test.name, key, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package vanity
+
+import (
+	"context"
+	"net/http"
+)
+
+type (
+	// importPathKey is the context key of the import path resolved while
+	// serving a request.
+	importPathKey struct{}
+)
+
+// WithImportPath returns a copy of ctx in which the handler records the import
+// path resolved for the request, readable from the returned pointer once the
+// request is served, e.g. to be logged.
+func WithImportPath(ctx context.Context) (context.Context, *string) {
+	importPath := new(string)
+	return context.WithValue(ctx, importPathKey{}, importPath), importPath
+}
+
+// setImportPath records the import path resolved for r, to be logged.
+func setImportPath(r *http.Request, importPath string) {
+	if p, ok := r.Context().Value(importPathKey{}).(*string); ok {
+		*p = importPath
+	}
+}
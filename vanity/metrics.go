@@ -0,0 +1,103 @@
+package vanity
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// histogram is a Prometheus histogram of durations, in seconds.
+	histogram struct {
+		// bounds are the upper bounds of the buckets, and counts the
+		// observations within each bucket, the last one being +Inf.
+		bounds []float64
+		counts []atomic.Uint64
+		sum    atomic.Int64 // in nanoseconds
+	}
+)
+
+var (
+	// metricsLabelEscaper escapes label values in the Prometheus text format.
+	metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	// latencyBuckets are the buckets of the request latency histogram, in
+	// seconds. Vanity pages are rendered from memory, so most requests fall
+	// well under a millisecond.
+	latencyBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1}
+)
+
+// newHistogram returns an empty histogram with buckets up to the sorted
+// bounds, plus +Inf.
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]atomic.Uint64, len(bounds)+1)}
+}
+
+// observe records the time elapsed since start.
+func (hg *histogram) observe(start time.Time) {
+	d := time.Since(start)
+	i := sort.SearchFloat64s(hg.bounds, d.Seconds())
+
+	hg.counts[i].Add(1)
+	hg.sum.Add(int64(d))
+}
+
+// write writes hg as the name metric to b, with cumulative buckets.
+func (hg *histogram) write(b io.Writer, name string) {
+	var count uint64
+
+	for i, bound := range hg.bounds {
+		count += hg.counts[i].Load()
+		fmt.Fprintf(b, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), count)
+	}
+
+	count += hg.counts[len(hg.bounds)].Load()
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, count)
+	fmt.Fprintf(b, "%s_sum %s\n", name, strconv.FormatFloat(time.Duration(hg.sum.Load()).Seconds(), 'g', -1, 64))
+	fmt.Fprintf(b, "%s_count %d\n", name, count)
+}
+
+// WriteMetrics writes the request counters of h to w in the Prometheus text
+// exposition format.
+func (h *Handler) WriteMetrics(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintln(b, "# HELP govanityurls_requests_total Requests served by the vanity handler.")
+	fmt.Fprintln(b, "# TYPE govanityurls_requests_total counter")
+	fmt.Fprintf(b, "govanityurls_requests_total %d\n", h.requests.Load())
+
+	fmt.Fprintln(b, "# HELP govanityurls_not_found_total Requests not matching any path.")
+	fmt.Fprintln(b, "# TYPE govanityurls_not_found_total counter")
+	fmt.Fprintf(b, "govanityurls_not_found_total %d\n", h.misses.Load())
+
+	paths := make([]string, 0, len(h.hits))
+	for path := range h.hits {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	fmt.Fprintln(b, "# HELP govanityurls_path_requests_total Requests served by each configured path.")
+	fmt.Fprintln(b, "# TYPE govanityurls_path_requests_total counter")
+
+	for _, path := range paths {
+		label := path
+		if label == "" {
+			label = "/"
+		}
+
+		fmt.Fprintf(b, "govanityurls_path_requests_total{path=\"%s\"} %d\n",
+			metricsLabelEscaper.Replace(label), h.hits[path].Load())
+	}
+
+	fmt.Fprintln(b, "# HELP govanityurls_request_duration_seconds Time taken by the vanity handler to serve requests.")
+	fmt.Fprintln(b, "# TYPE govanityurls_request_duration_seconds histogram")
+	h.latency.write(b, "govanityurls_request_duration_seconds")
+
+	return b.Flush()
+}
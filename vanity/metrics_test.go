@@ -0,0 +1,64 @@
+package vanity
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	h, err := NewHandler([]byte("paths:\n" +
+		"  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n" +
+		"  '/quo\"te':\n    repo: https://github.com/example/quote\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	for _, path := range []string{"/portmidi", "/portmidi/foo", "/other"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path+"?go-get=1", nil))
+	}
+
+	var b strings.Builder
+
+	if err := h.WriteMetrics(&b); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+
+	for _, want := range []string{
+		"govanityurls_requests_total 3\n",
+		"govanityurls_not_found_total 1\n",
+		"govanityurls_path_requests_total{path=\"/portmidi\"} 2\n",
+		"govanityurls_path_requests_total{path=\"/quo\\\"te\"} 0\n",
+		"govanityurls_request_duration_seconds_bucket{le=\"+Inf\"} 3\n",
+		"govanityurls_request_duration_seconds_count 3\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics = %q; want it to contain %q", b.String(), want)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	hg := newHistogram([]float64{.001, .01})
+
+	now := time.Now()
+	for _, d := range []time.Duration{500 * time.Microsecond, 5 * time.Millisecond, 6 * time.Millisecond, time.Second} {
+		hg.observe(now.Add(-d))
+	}
+
+	var b strings.Builder
+	hg.write(&b, "latency")
+
+	for _, want := range []string{
+		"latency_bucket{le=\"0.001\"} 1\n",
+		"latency_bucket{le=\"0.01\"} 3\n",
+		"latency_bucket{le=\"+Inf\"} 4\n",
+		"latency_count 4\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("histogram = %q; want it to contain %q", b.String(), want)
+		}
+	}
+}
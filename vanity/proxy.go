@@ -0,0 +1,158 @@
+package vanity
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+type (
+	// TrustedProxies are the networks whose forwarded headers are honored.
+	TrustedProxies []netip.Prefix
+
+	// proxyHandler is the http.Handler implementation for ProxyHandler.
+	proxyHandler struct {
+		trusted TrustedProxies
+		handler http.Handler
+	}
+
+	// forwardedHostHandler is the http.Handler implementation for
+	// ForwardedHostHandler.
+	forwardedHostHandler struct {
+		handler http.Handler
+	}
+)
+
+var (
+	// forwardedHeaders are the headers only trusted proxies may set.
+	forwardedHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto", "X-Real-Ip"}
+)
+
+// ParseTrustedProxies parses the trusted_proxies setting, made of CIDRs or
+// single IPs.
+func ParseTrustedProxies(proxies []string) (TrustedProxies, error) {
+	trusted := make(TrustedProxies, 0, len(proxies))
+
+	for _, proxy := range proxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(proxy)
+			if aerr != nil {
+				return nil, NewInvalidTrustedProxyError(proxy)
+			}
+
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		trusted = append(trusted, prefix.Masked())
+	}
+
+	return trusted, nil
+}
+
+// contains reports whether the IP of addr, with or without a port, is within
+// a trusted network.
+func (t TrustedProxies) contains(addr string) bool {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+
+	ip = ip.Unmap()
+
+	for _, prefix := range t {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the IP of the client behind the trusted proxies, from the
+// X-Forwarded-For header of r. Addresses are appended by each proxy, so the
+// rightmost untrusted one is the client, as anything left of it may be
+// spoofed.
+func (t TrustedProxies) clientIP(r *http.Request) string {
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+
+	client := ""
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+
+		client = hop
+
+		if !t.contains(hop) {
+			break
+		}
+	}
+
+	return client
+}
+
+func (h proxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.trusted.contains(r.RemoteAddr) {
+		r = r.Clone(r.Context())
+		for _, header := range forwardedHeaders {
+			r.Header.Del(header)
+		}
+	} else if ip := h.trusted.clientIP(r); ip != "" {
+		r = r.Clone(r.Context())
+		r.RemoteAddr = ip
+	}
+
+	h.handler.ServeHTTP(w, r)
+}
+
+// ProxyHandler returns a http.Handler that wraps h and only lets the proxies
+// within trusted set forwarded headers, e.g. X-Forwarded-Proto, which are
+// removed from other requests. The remote address of requests forwarded by
+// trusted proxies is set to the client IP of their X-Forwarded-For header.
+func ProxyHandler(trusted TrustedProxies, h http.Handler) http.Handler {
+	return proxyHandler{trusted, h}
+}
+
+// forwardedHost returns the host the client requested, from the
+// X-Forwarded-Host header of r, or "" when it's missing or isn't a host. The
+// first proxy sets it, so the leftmost value is the original one.
+func forwardedHost(r *http.Request) string {
+	host, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ",")
+	host = strings.TrimSpace(host)
+
+	if u, err := url.Parse("https://" + host); err != nil || u.Host != host {
+		return ""
+	}
+
+	return host
+}
+
+func (h forwardedHostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if host := forwardedHost(r); host != "" {
+		r = r.Clone(r.Context())
+		r.Host = host
+	}
+
+	h.handler.ServeHTTP(w, r)
+}
+
+// ForwardedHostHandler returns a http.Handler that wraps h and serves requests
+// for the host of their X-Forwarded-Host header, so that the import paths and
+// index links derived from the request use the public host rather than the
+// internal one a proxy forwarded to. Any client may set the header, so it
+// should only wrap handlers behind a proxy, or a ProxyHandler.
+func ForwardedHostHandler(h http.Handler) http.Handler {
+	return forwardedHostHandler{h}
+}
@@ -0,0 +1,169 @@
+package vanity
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProxyHandler(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		remote     string
+		https      bool
+	}{
+		{
+			name:       "untrusted peer",
+			remoteAddr: "203.0.113.7:1234",
+			forwarded:  "198.51.100.1",
+			remote:     "203.0.113.7:1234",
+		},
+		{
+			name:       "trusted peer",
+			remoteAddr: "10.1.2.3:1234",
+			forwarded:  "198.51.100.1",
+			remote:     "198.51.100.1",
+			https:      true,
+		},
+		{
+			name:       "trusted single IP",
+			remoteAddr: "192.0.2.1:1234",
+			forwarded:  "198.51.100.1",
+			remote:     "198.51.100.1",
+			https:      true,
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "10.1.2.3:1234",
+			forwarded:  "203.0.113.9, 198.51.100.1, 10.4.5.6",
+			remote:     "198.51.100.1",
+			https:      true,
+		},
+		{
+			name:       "without X-Forwarded-For",
+			remoteAddr: "10.1.2.3:1234",
+			remote:     "10.1.2.3:1234",
+			https:      true,
+		},
+	}
+
+	for _, test := range tests {
+		var got *http.Request
+
+		h := ProxyHandler(trusted, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r }))
+
+		r := httptest.NewRequest(http.MethodGet, "/portmidi", nil)
+		r.RemoteAddr = test.remoteAddr
+		r.Header.Set("X-Forwarded-Proto", "https")
+
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+
+		h.ServeHTTP(httptest.NewRecorder(), r)
+
+		if got.RemoteAddr != test.remote {
+			t.Errorf("%s: RemoteAddr = %q; want %q", test.name, got.RemoteAddr, test.remote)
+		}
+
+		if https := got.Header.Get("X-Forwarded-Proto") == "https"; https != test.https {
+			t.Errorf("%s: X-Forwarded-Proto kept = %v; want %v", test.name, https, test.https)
+		}
+	}
+}
+
+func TestForwardedHostHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		forwarded string
+		goImport  string
+		index     string
+	}{
+		{
+			name:     "without X-Forwarded-Host",
+			goImport: "vanity.internal/portmidi git https://github.com/rakyll/portmidi",
+			index:    `<a href="https://vanity.internal:8080/portmidi">vanity.internal/portmidi</a>`,
+		},
+		{
+			name:      "forwarded host",
+			forwarded: "go.example.com",
+			goImport:  "go.example.com/portmidi git https://github.com/rakyll/portmidi",
+			index:     `<a href="https://go.example.com/portmidi">go.example.com/portmidi</a>`,
+		},
+		{
+			name:      "chain of proxies",
+			forwarded: "go.example.com, edge.internal",
+			goImport:  "go.example.com/portmidi git https://github.com/rakyll/portmidi",
+			index:     `<a href="https://go.example.com/portmidi">go.example.com/portmidi</a>`,
+		},
+		{
+			name:      "not a host",
+			forwarded: "go.example.com/evil",
+			goImport:  "vanity.internal/portmidi git https://github.com/rakyll/portmidi",
+			index:     `<a href="https://vanity.internal:8080/portmidi">vanity.internal/portmidi</a>`,
+		},
+	}
+
+	h, err := NewHandler([]byte("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+
+	fh := ForwardedHostHandler(h)
+
+	for _, test := range tests {
+		serve := func(target string) string {
+			r := httptest.NewRequest(http.MethodGet, "http://vanity.internal:8080"+target, nil)
+			if test.forwarded != "" {
+				r.Header.Set("X-Forwarded-Host", test.forwarded)
+			}
+
+			w := httptest.NewRecorder()
+			fh.ServeHTTP(w, r)
+
+			return w.Body.String()
+		}
+
+		if got := findMeta([]byte(serve("/portmidi?go-get=1")), "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.name, got, test.goImport)
+		}
+
+		if index := serve("/"); !strings.Contains(index, test.index) {
+			t.Errorf("%s: index = %q; want it to contain %q", test.name, index, test.index)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	var perr *InvalidTrustedProxyError
+
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); !errors.As(err, &perr) {
+		t.Errorf("ParseTrustedProxies = %v; want an InvalidTrustedProxyError", err)
+	}
+
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.1/8", "::1"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+
+	for addr, want := range map[string]bool{
+		"10.255.0.1":          true,
+		"[::1]:8080":          true,
+		"[::ffff:10.0.0.1]:1": true,
+		"11.0.0.1:80":         false,
+		"not an address":      false,
+	} {
+		if got := trusted.contains(addr); got != want {
+			t.Errorf("contains(%q) = %v; want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package vanity
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	const old = "paths:\n" +
+		"  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n" +
+		"  /removed:\n    repo: https://github.com/example/removed\n" +
+		"  /changed:\n    repo: https://github.com/example/changed\n" +
+		"  /dup/:\n    repo: https://github.com/example/dup\n"
+
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{
+			name:   "unchanged",
+			config: old,
+		},
+		{
+			name: "paths",
+			config: "paths:\n" +
+				"  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n" +
+				"  /changed:\n    repo: https://github.com/example/changed\n    branch: main\n" +
+				"  /added:\n    repo: https://github.com/example/added\n" +
+				"  /dup:\n    repo: https://github.com/example/dup\n" +
+				"  /zzz:\n    repo: https://github.com/example/zzz\n",
+		},
+		{
+			name:   "cache max age",
+			config: old + "    cache_max_age: 60\n",
+		},
+		{
+			name:   "default branch",
+			config: "default_branch: main\n" + old,
+		},
+		{
+			name:   "root module",
+			config: "root_module:\n  repo: https://github.com/example/root\n" + old,
+		},
+		{
+			name: "list",
+			config: "paths:\n" +
+				"  - path: /dup\n    repo: https://github.com/example/other\n" +
+				"  - path: /dup\n    repo: https://github.com/example/dup\n" +
+				"  - path: /portmidi\n    repo: https://github.com/rakyll/portmidi\n",
+		},
+	}
+	for _, test := range tests {
+		h, err := NewHandler([]byte(old))
+		if err != nil {
+			t.Fatalf("newHandler: %v", err)
+		}
+
+		h.hits["/portmidi"].Add(3)
+
+		parsed, err := ParseConfig([]byte(test.config))
+		if err != nil {
+			t.Errorf("%s: ParseConfig: %v", test.name, err)
+			continue
+		}
+
+		reloaded, err := h.Reload(parsed)
+		if err != nil {
+			t.Errorf("%s: Reload: %v", test.name, err)
+			continue
+		}
+
+		want, err := NewHandlerFromConfig(parsed)
+		if err != nil {
+			t.Errorf("%s: NewHandlerFromConfig: %v", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(reloaded.paths, want.paths) {
+			t.Errorf("%s: paths = %v; want %v", test.name, reloaded.paths, want.paths)
+		}
+
+		if got := reloaded.hits["/portmidi"].Load(); got != 3 {
+			t.Errorf("%s: hits = %d; want 3", test.name, got)
+		}
+	}
+}
+
+func TestReloadInvalid(t *testing.T) {
+	h, err := NewHandler([]byte("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	parsed, err := ParseConfig([]byte("paths:\n  /portmidi:\n    repo: https://example.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+
+	if _, err := h.Reload(parsed); err == nil {
+		t.Error("Reload: want an error for a path without VCS")
+	}
+}
+
+func BenchmarkReload(b *testing.B) {
+	config := func(changed string) *Config {
+		var sb strings.Builder
+
+		sb.WriteString("paths:\n")
+
+		for i := range 10000 {
+			fmt.Fprintf(&sb, "  /pkg%d:\n    repo: https://github.com/example/pkg%d\n", i, i)
+		}
+
+		fmt.Fprintf(&sb, "  /changed:\n    repo: https://github.com/example/%s\n", changed)
+
+		parsed, err := ParseConfig([]byte(sb.String()))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		return parsed
+	}
+
+	h, err := NewHandlerFromConfig(config("old"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	parsed := config("new")
+
+	b.Run("full", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := NewHandlerFromConfig(parsed); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("incremental", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := h.Reload(parsed); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
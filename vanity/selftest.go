@@ -0,0 +1,45 @@
+package vanity
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+)
+
+// SelfTest renders the index and the vanity page of every configured path
+// against synthetic requests, so that template or config issues surface before
+// any client traffic arrives.
+func (h *Handler) SelfTest() error {
+	paths := []string{"/"}
+	if h.indexPath != "" {
+		paths[0] = h.indexPath
+	}
+
+	for _, pc := range h.paths {
+		paths = append(paths, "/"+strings.TrimPrefix(pc.Path, "/")+"?go-get=1")
+	}
+
+	// Synthetic requests don't count, so they are served by a copy of h with
+	// its own counters, as those of h may be shared with a handler serving
+	// traffic, e.g. by Reload.
+	scratch := *h
+	scratch.requests, scratch.misses, scratch.latency = new(atomic.Uint64), new(atomic.Uint64), newHistogram(latencyBuckets)
+	scratch.hits = make(map[string]*atomic.Uint64, len(h.hits))
+
+	for path := range h.hits {
+		scratch.hits[path] = new(atomic.Uint64)
+	}
+
+	for _, path := range paths {
+		w := httptest.NewRecorder()
+		scratch.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if w.Code >= http.StatusBadRequest {
+			return fmt.Errorf("self-test: GET %s: %d %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package vanity
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type (
+	// Snapshot is a point in time copy of the hit counters of a handler.
+	Snapshot struct {
+		Time      time.Time         `json:"time"`
+		Started   time.Time         `json:"started"`
+		TotalHits uint64            `json:"total_hits"`
+		Hits      map[string]uint64 `json:"hits"`
+	}
+)
+
+// Snapshot returns the current hits of every configured path, keyed by path.
+func (h *Handler) Snapshot() Snapshot {
+	s := Snapshot{
+		Time:    time.Now(),
+		Started: h.started,
+		Hits:    make(map[string]uint64, len(h.hits)),
+	}
+
+	for path, hits := range h.hits {
+		if path == "" {
+			path = "/"
+		}
+
+		s.Hits[path] = hits.Load()
+		s.TotalHits += s.Hits[path]
+	}
+
+	return s
+}
+
+// WriteSnapshot writes the snapshot of h to path as JSON. The file is
+// replaced atomically, so that readers never see a partial snapshot.
+func (h *Handler) WriteSnapshot(path string) error {
+	b, err := json.MarshalIndent(h.Snapshot(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	// CreateTemp only lets the owner read it, unlike the sidecars and
+	// cron jobs the snapshot is usually collected by.
+	if err := f.Chmod(0o644); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
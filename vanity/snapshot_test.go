@@ -0,0 +1,56 @@
+package vanity
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteSnapshot(t *testing.T) {
+	h, err := NewHandler([]byte("paths:\n" +
+		"  /:\n    repo: https://github.com/example/root\n" +
+		"  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"))
+	if err != nil {
+		t.Fatalf("newHandler: %v", err)
+	}
+
+	for _, path := range []string{"/portmidi", "/portmidi/foo", "/other"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	path := filepath.Join(t.TempDir(), "hits.json")
+
+	if err := h.WriteSnapshot(path); err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	var got Snapshot
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if want := map[string]uint64{"/": 1, "/portmidi": 2}; !reflect.DeepEqual(got.Hits, want) {
+		t.Errorf("hits = %v; want %v", got.Hits, want)
+	}
+
+	if got.TotalHits != 3 {
+		t.Errorf("total hits = %d; want 3", got.TotalHits)
+	}
+
+	if !got.Started.Equal(h.started) || got.Time.Before(got.Started) {
+		t.Errorf("time = %v, started = %v; want started %v before time", got.Time, got.Started, h.started)
+	}
+
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("%d files left in the snapshot directory; want 1", len(entries))
+	}
+}
@@ -0,0 +1,49 @@
+package vanity
+
+import (
+	"crypto/tls"
+	"strings"
+)
+
+var (
+	// tlsCurves maps the curve names accepted in the tls block to their IDs.
+	tlsCurves = map[string]tls.CurveID{
+		"x25519": tls.X25519,
+		"p256":   tls.CurveP256,
+		"p384":   tls.CurveP384,
+		"p521":   tls.CurveP521,
+	}
+)
+
+// Config returns the tls.Config restricted to the configured cipher suites and
+// curves, or Go's defaults when unset. TLS 1.0 and 1.1 are always disabled.
+func (t TLS) Config() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	// Only the suites Go considers secure are accepted; the insecure ones are
+	// listed separately by tls.InsecureCipherSuites.
+	suites := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		suites[s.Name] = s.ID
+	}
+
+	for _, name := range t.CipherSuites {
+		id, ok := suites[name]
+		if !ok {
+			return nil, NewInvalidTLSSettingError("cipher suite", name)
+		}
+
+		config.CipherSuites = append(config.CipherSuites, id)
+	}
+
+	for _, name := range t.Curves {
+		id, ok := tlsCurves[strings.ReplaceAll(strings.ToLower(name), "-", "")]
+		if !ok {
+			return nil, NewInvalidTLSSettingError("curve", name)
+		}
+
+		config.CurvePreferences = append(config.CurvePreferences, id)
+	}
+
+	return config, nil
+}
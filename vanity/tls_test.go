@@ -0,0 +1,40 @@
+package vanity
+
+import (
+	"crypto/tls"
+	"slices"
+	"testing"
+)
+
+func TestTLSConfig(t *testing.T) {
+	config, err := TLS{
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		Curves:       []string{"X25519", "P-256"},
+	}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %x; want %x", config.MinVersion, tls.VersionTLS12)
+	}
+
+	suites := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}
+	if !slices.Equal(config.CipherSuites, suites) {
+		t.Errorf("CipherSuites = %v; want %v", config.CipherSuites, suites)
+	}
+
+	curves := []tls.CurveID{tls.X25519, tls.CurveP256}
+	if !slices.Equal(config.CurvePreferences, curves) {
+		t.Errorf("CurvePreferences = %v; want %v", config.CurvePreferences, curves)
+	}
+
+	config, err = TLS{}.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.CipherSuites != nil || config.CurvePreferences != nil {
+		t.Errorf("default config = %+v; want Go's defaults", config)
+	}
+}
@@ -0,0 +1,95 @@
+package vanity
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+type (
+	// traceContextHandler is the http.Handler implementation for
+	// TraceContextHandler.
+	traceContextHandler struct {
+		handler http.Handler
+	}
+)
+
+func (h traceContextHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	traceID, flags, ok := parseTraceparent(r.Header.Get("traceparent"))
+	if !ok {
+		// tracestate is meaningless without a valid traceparent.
+		traceID, flags = randomHex(16), "00"
+		r.Header.Del("tracestate")
+	}
+
+	traceparent := "00-" + traceID + "-" + randomHex(8) + "-" + flags
+
+	r.Header.Set("traceparent", traceparent)
+	w.Header().Set("traceparent", traceparent)
+
+	if tracestate := r.Header.Get("tracestate"); tracestate != "" {
+		w.Header().Set("tracestate", tracestate)
+	}
+
+	h.handler.ServeHTTP(w, r)
+}
+
+// TraceContextHandler returns a http.Handler that wraps h and propagates the
+// W3C trace context: the trace of the traceparent request header is continued
+// with a new span, or a new trace is started when it is missing or invalid.
+// The resulting traceparent is set on the request passed to h, e.g. for
+// logging, and echoed in the response along with tracestate.
+//
+// See https://www.w3.org/TR/trace-context/.
+func TraceContextHandler(h http.Handler) http.Handler {
+	return traceContextHandler{h}
+}
+
+// parseTraceparent returns the trace ID and flags of a valid traceparent.
+func parseTraceparent(traceparent string) (traceID, flags string, ok bool) {
+	fields := strings.Split(traceparent, "-")
+	if len(fields) < 4 || !isHex(fields[0], 1) || fields[0] == "ff" || (fields[0] == "00" && len(fields) != 4) {
+		return "", "", false
+	}
+
+	if !isHex(fields[1], 16) || !isHex(fields[2], 8) || !isHex(fields[3], 1) {
+		return "", "", false
+	}
+
+	// All zero trace and parent IDs are invalid.
+	if strings.Trim(fields[1], "0") == "" || strings.Trim(fields[2], "0") == "" {
+		return "", "", false
+	}
+
+	return fields[1], fields[3], true
+}
+
+// TraceID returns the trace ID of the traceparent header of r, if valid.
+func TraceID(r *http.Request) string {
+	id, _, _ := parseTraceparent(r.Header.Get("traceparent"))
+	return id
+}
+
+// isHex reports whether s is the lowercase hex encoding of n bytes.
+func isHex(s string, n int) bool {
+	if len(s) != 2*n {
+		return false
+	}
+
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
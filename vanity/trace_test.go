@@ -0,0 +1,91 @@
+package vanity
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTraceContextHandler(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	tests := []struct {
+		name        string
+		traceparent string
+		tracestate  string
+		continued   bool
+	}{
+		{
+			name:        "continued",
+			traceparent: "00-" + traceID + "-00f067aa0ba902b7-01",
+			tracestate:  "congo=t61rcWkgMzE",
+			continued:   true,
+		},
+		{
+			name:        "future version",
+			traceparent: "cc-" + traceID + "-00f067aa0ba902b7-01-extra",
+			continued:   true,
+		},
+		{
+			name: "missing",
+		},
+		{
+			name:        "zero trace id",
+			traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			tracestate:  "congo=t61rcWkgMzE",
+		},
+		{
+			name:        "uppercase",
+			traceparent: "00-" + strings.ToUpper(traceID) + "-00f067aa0ba902b7-01",
+		},
+	}
+	for _, test := range tests {
+		var logged string
+
+		h := TraceContextHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { logged = TraceID(r) }))
+
+		r := httptest.NewRequest(http.MethodGet, "/portmidi", nil)
+		if test.traceparent != "" {
+			r.Header.Set("traceparent", test.traceparent)
+		}
+
+		if test.tracestate != "" {
+			r.Header.Set("tracestate", test.tracestate)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		id, flags, ok := parseTraceparent(w.Header().Get("traceparent"))
+		if !ok {
+			t.Errorf("%s: invalid traceparent %q", test.name, w.Header().Get("traceparent"))
+			continue
+		}
+
+		if got := id == traceID; got != test.continued {
+			t.Errorf("%s: trace continued = %v; want %v", test.name, got, test.continued)
+		}
+
+		if test.continued && flags != "01" {
+			t.Errorf("%s: flags = %q; want 01", test.name, flags)
+		}
+
+		if w.Header().Get("traceparent") == test.traceparent {
+			t.Errorf("%s: traceparent wasn't given a new span", test.name)
+		}
+
+		wantState := ""
+		if test.continued {
+			wantState = test.tracestate
+		}
+
+		if got := w.Header().Get("tracestate"); got != wantState {
+			t.Errorf("%s: tracestate = %q; want %q", test.name, got, wantState)
+		}
+
+		if logged != id {
+			t.Errorf("%s: TraceID = %q; want %q", test.name, logged, id)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package vanity
+
+import (
+	"sort"
+	"strings"
+)
+
+type (
+	// wildcardPath is a path ending with a wildcard element, e.g. "/x/*",
+	// standing for every path under prefix. The element matched by the
+	// wildcard replaces the {name} placeholders of entry.
+	wildcardPath struct {
+		prefix string // e.g. "/x/", always ending with a slash
+		entry  Path
+	}
+)
+
+// isWildcard reports whether e is a wildcard path, valid or not.
+func (e Path) isWildcard() bool {
+	return strings.Contains(e.Path, "*")
+}
+
+// expand returns the entry of the path under w whose wildcard element is name.
+func (w wildcardPath) expand(name string) Path {
+	e := w.entry
+	e.Path = w.prefix + name
+	e.Repo = strings.ReplaceAll(e.Repo, "{name}", name)
+	e.SourceRepo = strings.ReplaceAll(e.SourceRepo, "{name}", name)
+	e.Display = strings.ReplaceAll(e.Display, "{name}", name)
+
+	return e
+}
+
+// wildcards returns the wildcard paths of c, the longest prefix first. Their
+// entries are checked as if their wildcard matched "name", so that a repo
+// whose VCS can't be inferred fails at startup rather than per request.
+func (c *Config) wildcards() ([]wildcardPath, error) {
+	var wildcards []wildcardPath
+
+	for _, e := range c.Paths {
+		if !e.isWildcard() {
+			continue
+		}
+
+		prefix, ok := strings.CutSuffix(strings.TrimSuffix(e.Path, "/"), "*")
+		if !ok || !strings.HasSuffix(prefix, "/") || strings.Contains(prefix, "*") {
+			return nil, NewInvalidWildcardError(e.Path)
+		}
+
+		w := wildcardPath{prefix, e}
+
+		if _, err := c.pathConfig(e.Path, w.expand("name")); err != nil {
+			return nil, err
+		}
+
+		wildcards = append(wildcards, w)
+	}
+
+	sort.SliceStable(wildcards, func(i, j int) bool {
+		return len(wildcards[i].prefix) > len(wildcards[j].prefix)
+	})
+
+	return wildcards, nil
+}
+
+// findWildcard resolves path using the wildcard paths, e.g. given "/x/*" for
+// the repo "https://github.com/acme/{name}", "/x/foo/bar" resolves to the repo
+// https://github.com/acme/foo with a subpath of "bar".
+func (h *Handler) findWildcard(path string) (*PathConfig, string) {
+	for _, w := range h.wildcards {
+		rest, ok := strings.CutPrefix(path, w.prefix)
+		if !ok {
+			continue
+		}
+
+		name, subpath, _ := strings.Cut(rest, "/")
+		if !isWildcardName(name) {
+			continue
+		}
+
+		pc, err := h.config.pathConfig(w.prefix+name, w.expand(name))
+		if err != nil {
+			return nil, ""
+		}
+
+		return &pc, subpath
+	}
+
+	return nil, ""
+}
+
+// isWildcardName reports whether name can be matched by a wildcard. It is
+// substituted in URLs, so it is restricted to the characters of the path
+// elements of Go modules.
+func isWildcardName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+
+	for _, r := range name {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case r == '-', r == '.', r == '_', r == '~':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,94 @@
+package vanity
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWildcardPaths(t *testing.T) {
+	h, err := NewHandler([]byte("host: example.com\n" +
+		"root_module:\n" +
+		"  repo: https://github.com/acme/root\n" +
+		"paths:\n" +
+		"  /x/*:\n" +
+		"    repo: https://github.com/acme/{name}\n" +
+		"  /x/special:\n" +
+		"    repo: https://gitlab.com/acme/special\n" +
+		"  /x/tools/*:\n" +
+		"    repo: https://github.com/acme-tools/{name}\n"))
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		goImport string
+	}{
+		{
+			name:     "substitution",
+			path:     "/x/foo",
+			goImport: "example.com/x/foo git https://github.com/acme/foo",
+		},
+		{
+			name:     "subpath",
+			path:     "/x/foo/bar/baz",
+			goImport: "example.com/x/foo git https://github.com/acme/foo",
+		},
+		{
+			name:     "exact match first",
+			path:     "/x/special/bar",
+			goImport: "example.com/x/special git https://gitlab.com/acme/special",
+		},
+		{
+			name:     "longest wildcard first",
+			path:     "/x/tools/lint",
+			goImport: "example.com/x/tools/lint git https://github.com/acme-tools/lint",
+		},
+		{
+			name:     "shorter configured prefix",
+			path:     "/y",
+			goImport: "example.com git https://github.com/acme/root",
+		},
+		{
+			name:     "invalid name",
+			path:     "/x/..",
+			goImport: "example.com git https://github.com/acme/root",
+		},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path+"?go-get=1", nil))
+
+		if got := findMeta(w.Body.Bytes(), "go-import"); got != test.goImport {
+			t.Errorf("%s: meta go-import = %q; want %q", test.name, got, test.goImport)
+		}
+	}
+
+	for _, pc := range h.PathConfigs() {
+		if strings.Contains(pc.Path, "*") {
+			t.Errorf("PathConfigs contains the wildcard path %s", pc.Path)
+		}
+	}
+}
+
+func TestWildcardPathInvalid(t *testing.T) {
+	for _, path := range []string{"/x/*/y", "/x*", "/*/*"} {
+		_, err := NewHandler([]byte("paths:\n  " + path + ":\n    repo: https://github.com/acme/{name}\n"))
+
+		var wildcardErr *InvalidWildcardError
+		if !errors.As(err, &wildcardErr) {
+			t.Errorf("%s: NewHandler = %v; want an InvalidWildcardError", path, err)
+		}
+	}
+
+	_, err := NewHandler([]byte("paths:\n  /x/*:\n    repo: https://example.com/acme/{name}\n"))
+
+	var vcsErr *InvalidVCSError
+	if !errors.As(err, &vcsErr) {
+		t.Errorf("unknown VCS: NewHandler = %v; want an InvalidVCSError", err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+)
+
+const (
+	verifyConcurrency = 8
+	verifyTimeout     = 10 * time.Second
+)
+
+type (
+	// repoCheck is the outcome of checking that a configured repo exists.
+	repoCheck struct {
+		repo string
+		err  error
+	}
+)
+
+// verifyRepos checks that the repo of every path of pset exists, with up to
+// verifyConcurrency requests in flight. The checks are sorted by repo.
+func verifyRepos(client *http.Client, pset vanity.PathConfigSet) []repoCheck {
+	seen := make(map[string]bool, len(pset))
+	checks := make([]repoCheck, 0, len(pset))
+
+	for _, pc := range pset {
+		if !seen[pc.Repo] {
+			seen[pc.Repo] = true
+			checks = append(checks, repoCheck{repo: pc.Repo})
+		}
+	}
+
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].repo < checks[j].repo
+	})
+
+	var wg sync.WaitGroup
+
+	sem := make(chan struct{}, verifyConcurrency)
+
+	for i := range checks {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			checks[i].err = checkRepo(client, checks[i].repo)
+		}()
+	}
+
+	wg.Wait()
+
+	return checks
+}
+
+// checkRepo fails unless a HEAD request for repo succeeds, falling back to GET
+// for servers that don't allow HEAD.
+func checkRepo(client *http.Client, repo string) error {
+	status, err := requestRepo(client, http.MethodHead, repo)
+	if err == nil && status == http.StatusMethodNotAllowed {
+		status, err = requestRepo(client, http.MethodGet, repo)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if status < 200 || status > 299 {
+		return NewRepoStatusError(repo, status)
+	}
+
+	return nil
+}
+
+// requestRepo returns the status of the method request for repo.
+func requestRepo(client *http.Client, method, repo string) (int, error) {
+	req, err := http.NewRequest(method, repo, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+// reportRepos writes the outcome of checks to w, and returns the exit code of
+// -verify-repos: 1 if any repo is unreachable.
+func reportRepos(w io.Writer, checks []repoCheck) int {
+	var unreachable int
+
+	for _, check := range checks {
+		if check.err != nil {
+			unreachable++
+
+			fmt.Fprintf(w, "unreachable %s: %v\n", check.repo, check.err)
+		}
+	}
+
+	fmt.Fprintf(w, "%d reachable, %d unreachable\n", len(checks)-unreachable, unreachable)
+
+	if unreachable > 0 {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/govanityurls/vanity"
+)
+
+func TestVerifyRepos(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/gone":
+			http.NotFound(w, r)
+		case r.URL.Path == "/nohead" && r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer srv.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	pset := vanity.PathConfigSet{
+		{Path: "/a", Repo: srv.URL + "/ok"},
+		{Path: "/b", Repo: srv.URL + "/ok"},
+		{Path: "/c", Repo: srv.URL + "/gone"},
+		{Path: "/d", Repo: srv.URL + "/nohead"},
+		{Path: "/e", Repo: down.URL + "/down"},
+	}
+
+	checks := verifyRepos(srv.Client(), pset)
+
+	want := map[string]bool{
+		srv.URL + "/gone":   false,
+		srv.URL + "/nohead": true,
+		srv.URL + "/ok":     true,
+		down.URL + "/down":  false,
+	}
+
+	if len(checks) != len(want) {
+		t.Fatalf("checks = %v; want one per repo", checks)
+	}
+
+	for _, check := range checks {
+		if ok := check.err == nil; ok != want[check.repo] {
+			t.Errorf("%s: err = %v; want reachable %v", check.repo, check.err, want[check.repo])
+		}
+
+		var statusErr *RepoStatusError
+		if check.repo == srv.URL+"/gone" && (!errors.As(check.err, &statusErr) || statusErr.status != http.StatusNotFound) {
+			t.Errorf("%s: err = %v; want a 404 RepoStatusError", check.repo, check.err)
+		}
+	}
+
+	var out bytes.Buffer
+	if code := reportRepos(&out, checks); code != 1 {
+		t.Errorf("reportRepos = %d; want 1", code)
+	}
+
+	if got, want := out.String(), "2 reachable, 2 unreachable\n"; !bytes.HasSuffix(out.Bytes(), []byte(want)) {
+		t.Errorf("report = %q; want it to end with %q", got, want)
+	}
+}
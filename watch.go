@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// watchDebounce is how long the watcher waits for changes to settle
+	// before reloading, as editors usually write a file in several steps.
+	watchDebounce = 100 * time.Millisecond
+
+	// kubernetesData is the symlink atomically swapped by Kubernetes when
+	// a mounted ConfigMap or Secret is updated.
+	kubernetesData = "..data"
+)
+
+// watch reloads the config whenever the local files of l change, until done
+// is closed. The directories of the files are watched rather than the files
+// themselves, so that files replaced by a rename, as most editors and
+// Kubernetes do, keep being watched.
+func watch(boot *BootstrapHandler, l loader, done <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	defer watcher.Close()
+
+	files := make(map[string]bool)
+
+	for _, path := range []string{l.path, l.canary} {
+		if path == "" || path == "-" || isRemoteConfig(path) {
+			continue
+		}
+
+		path = filepath.Clean(path)
+		files[path] = true
+		files[filepath.Join(filepath.Dir(path), kubernetesData)] = true
+
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			return err
+		}
+	}
+
+	if len(files) == 0 {
+		return ErrWatchRequiresFile
+	}
+
+	changed := time.NewTimer(0)
+	<-changed.C
+
+	for {
+		select {
+		case <-done:
+			return nil
+		case event := <-watcher.Events:
+			if files[filepath.Clean(event.Name)] && !event.Has(fsnotify.Chmod) {
+				changed.Reset(watchDebounce)
+			}
+		case err := <-watcher.Errors:
+			log.Printf("Watching %s: %v", l.path, err)
+		case <-changed.C:
+			reload(boot, l)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	defer active.Store(nil)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vanity.yaml")
+
+	if err := os.WriteFile(path, []byte("paths:\n  /portmidi:\n    repo: https://github.com/rakyll/portmidi\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	l := loader{path: path, selftest: true}
+
+	_, handler, serving, err := l.load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	boot := NewBootstrapHandler(time.Second)
+	active.Store(handler)
+	boot.Set(serving)
+
+	done := make(chan struct{})
+	watching := make(chan error, 1)
+
+	go func() { watching <- watch(boot, l, done) }()
+
+	// Like most editors, replace the file by a rename rather than in place.
+	// The watcher may still be starting, so the change is made until seen.
+	temp := filepath.Join(dir, "vanity.yaml.tmp")
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		if err := os.WriteFile(temp, []byte("paths:\n  /gopdf:\n    repo: https://github.com/zombiezen/gopdf\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Rename(temp, path); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(2 * watchDebounce)
+
+		w := httptest.NewRecorder()
+		boot.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/gopdf?go-get=1", nil))
+
+		if w.Code == http.StatusOK {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("/gopdf status = %d after the config changed; want %d", w.Code, http.StatusOK)
+		}
+	}
+
+	close(done)
+
+	if err := <-watching; err != nil {
+		t.Errorf("watch: %v", err)
+	}
+}
+
+func TestWatchRemote(t *testing.T) {
+	err := watch(NewBootstrapHandler(time.Second), loader{path: "https://example.com/vanity.yaml"}, nil)
+	if !errors.Is(err, ErrWatchRequiresFile) {
+		t.Errorf("watch = %v; want %v", err, ErrWatchRequiresFile)
+	}
+}